@@ -1,21 +1,26 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/tanema/pb/src/pstore"
 	"github.com/tanema/pb/src/stages"
 	"github.com/tanema/pb/src/term"
 )
 
 func main() {
-	if in, err := term.ParseInput(); err != nil {
+	if in, err := term.ParseInput(); errors.Is(err, pstore.ErrTampered) {
+		fmt.Println("You tampered with the box! It won't open for you anymore. Run pb --reset to start over.")
+		os.Exit(1)
+	} else if err != nil {
 		fmt.Println("There was a problem.")
 		if in.HasFlags("V") {
 			fmt.Println(err)
 		}
 		os.Exit(1)
-	} else if err := stages.Run(in); err != nil {
-		fmt.Fprint(os.Stderr, err)
+	} else {
+		os.Exit(stages.Main(in))
 	}
 }
@@ -1,57 +1,354 @@
 package artifacts
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/tanema/pb/src/pstore"
 )
 
-func get(db *pstore.DB) []string {
-	raw := db.Get("artifacts")
-	if raw == "" {
-		return []string{}
-	}
-	return strings.Split(db.Get("artifacts"), ";")
+// Artifact is something that pb has created, with enough recorded about it to
+// tell if it has been changed since. Ephemeral artifacts only exist while the
+// process that created them is running.
+type Artifact struct {
+	Kind      string    `json:"kind"`
+	Path      string    `json:"path"`
+	Stage     string    `json:"stage,omitempty"`
+	Hash      string    `json:"sha256,omitempty"`
+	Created   time.Time `json:"created"`
+	Ephemeral bool      `json:"ephemeral,omitempty"`
+	PID       int       `json:"pid,omitempty"`
+	Started   string    `json:"started,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Size      int64     `json:"-"`
+	Allowed   bool      `json:"-"`
 }
 
-func set(db *pstore.DB, artifacts []string) {
-	db.Set("artifacts", strings.Join(artifacts, ";"))
+const (
+	// KindFile is a regular file
+	KindFile = "file"
+	// KindDir is a directory
+	KindDir = "dir"
+	// KindSocket is a unix socket
+	KindSocket = "socket"
+	// KindPort is a listening port, its path is the address
+	KindPort = "port"
+	// KindProcess is a running pb process, its path is the command
+	KindProcess = "process"
+	// KindSignal is a signal handler, its path is the signal
+	KindSignal = "signal"
+
+	// StatusOK means the artifact is how pb left it
+	StatusOK = "ok"
+	// StatusModified means the artifact has been changed by someone else
+	StatusModified = "modified"
+	// StatusMissing means the artifact is gone
+	StatusMissing = "missing"
+)
+
+func init() {
+	pstore.RegisterMigration(2, manifest)
 }
 
-// Add will add a new artifact path to the config
-func Add(db *pstore.DB, artf string) {
-	if artf == "" {
+func get(db *pstore.DB) []Artifact {
+	artifacts := []Artifact{}
+	db.Namespace(pstore.ArtifactsNS).JSON("manifest", &artifacts)
+	return artifacts
+}
+
+// modify will change the latest manifest so that changes made by other pb
+// processes, like one that is listening, are not lost.
+func modify(db *pstore.DB, fn func([]Artifact) []Artifact) {
+	db.Namespace(pstore.ArtifactsNS).Update("manifest", func(val string) string {
+		artifacts := []Artifact{}
+		json.Unmarshal([]byte(val), &artifacts)
+		raw, _ := json.Marshal(fn(artifacts))
+		return string(raw)
+	})
+}
+
+// Add will record that the stage created an artifact of the kind at the path.
+// If pb changes an artifact it already created, the new hash is recorded but it
+// keeps the stage and time that it was first created.
+func Add(db *pstore.DB, kind, path, stage string) {
+	if path == "" {
 		return
 	}
-	artifacts := get(db)
-	for _, path := range artifacts {
-		if path == artf {
+	artf := Artifact{Kind: kind, Path: path, Stage: stage, Hash: hash(kind, path), Created: time.Now().UTC()}
+	for _, existing := range get(db) {
+		if existing.Path == path && existing.Kind == artf.Kind && existing.Hash == artf.Hash {
 			return
 		}
 	}
-	set(db, append(artifacts, artf))
+	modify(db, func(artifacts []Artifact) []Artifact {
+		for i, existing := range artifacts {
+			if existing.Path == path {
+				artf.Stage, artf.Created = existing.Stage, existing.Created
+				artifacts[i] = artf
+				return artifacts
+			}
+		}
+		return append(artifacts, artf)
+	})
+}
+
+// Track will record an ephemeral artifact, like a listening port, that this
+// process holds until the returned release func is called.
+func Track(db *pstore.DB, kind, path, stage string) func() {
+	pid := os.Getpid()
+	artf := Artifact{Kind: kind, Path: path, Stage: stage, Created: time.Now().UTC(), Ephemeral: true, PID: pid, Started: started(pid)}
+	modify(db, func(artifacts []Artifact) []Artifact {
+		return append(without(artifacts, func(existing Artifact) bool {
+			return existing.Ephemeral && !running(existing)
+		}), artf)
+	})
+	return func() {
+		modify(db, func(artifacts []Artifact) []Artifact {
+			return without(artifacts, func(existing Artifact) bool {
+				return existing.Path == path && existing.Kind == kind && existing.PID == pid
+			})
+		})
+	}
 }
 
 // Remove will remove an artifact path from the config
-func Remove(db *pstore.DB, artf string) {
-	artifacts := get(db)
-	for i, path := range artifacts {
-		if path == artf {
-			set(db, append(artifacts[:i], artifacts[i+1:]...))
+func Remove(db *pstore.DB, path string) {
+	modify(db, func(artifacts []Artifact) []Artifact {
+		return without(artifacts, func(artf Artifact) bool { return artf.Path == path })
+	})
+}
+
+// Prune will remove ephemeral artifacts whose process has exited without
+// releasing them.
+func Prune(db *pstore.DB) {
+	for _, artf := range get(db) {
+		if artf.Ephemeral && !running(artf) {
+			modify(db, func(artifacts []Artifact) []Artifact {
+				return without(artifacts, func(artf Artifact) bool { return artf.Ephemeral && !running(artf) })
+			})
 			return
 		}
 	}
 }
 
-// Print will output a list of all of the artifacts
-func Print(db *pstore.DB) {
-	fmt.Print(strings.Join(get(db), "\n"))
+// Live will return the ephemeral artifacts that are still held by a running
+// process
+func Live(db *pstore.DB) []Artifact {
+	live := []Artifact{}
+	for _, artf := range get(db) {
+		if artf.Ephemeral && running(artf) {
+			live = append(live, artf)
+		}
+	}
+	return live
+}
+
+// Stop will interrupt the process holding an ephemeral artifact so that it can
+// shut down and release it.
+func Stop(artf Artifact) error {
+	if !artf.Ephemeral || artf.PID == os.Getpid() {
+		return fmt.Errorf("cannot stop %v %v", artf.Kind, artf.Path)
+	} else if !running(artf) {
+		return nil
+	} else if err := stop(artf.PID); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
 }
 
-// Setup will ensure that the config path is in the config
+// running will check that the process holding an artifact is still the one
+// that created it. Once a process exits its pid can be given to another one, so
+// a process that started at a different time is someone else's.
+func running(artf Artifact) bool {
+	return artf.Started != "" && alive(artf.PID) && started(artf.PID) == artf.Started
+}
+
+func without(artifacts []Artifact, match func(Artifact) bool) []Artifact {
+	kept := []Artifact{}
+	for _, artf := range artifacts {
+		if !match(artf) {
+			kept = append(kept, artf)
+		}
+	}
+	return kept
+}
+
+// Print will output a list of the paths of all the artifacts on disk
+func Print(w io.Writer, db *pstore.DB) {
+	paths := []string{}
+	for _, artf := range get(db) {
+		if !artf.Ephemeral {
+			paths = append(paths, artf.Path)
+		}
+	}
+	fmt.Fprint(w, strings.Join(paths, "\n"))
+}
+
+// Setup will ensure that the directory pb made for the data is in the config
+// and forget any ephemeral artifacts left behind by processes that have exited.
+// Data saved somewhere the player chose is left alone.
 func Setup(db *pstore.DB) {
-	Add(db, filepath.Join(os.Getenv("HOME"), ".config", "pb"))
+	Prune(db)
+	if dir := db.Dir(); dir != "" {
+		Add(db, KindDir, dir, "")
+	}
+}
+
+// List will return all of the artifacts with their sizes. An artifact is only
+// allowed to be removed if it is one of the roots or within one of them. The
+// directory the data is saved in is listed last so that it is cleaned after
+// everything else has been removed from the list.
+func List(db *pstore.DB, roots ...string) []Artifact {
+	artifacts := get(db)
+	for i, artf := range artifacts {
+		artifacts[i].Size = size(artf.Path)
+		artifacts[i].Allowed = artf.Ephemeral || within(artf.Path, roots)
+	}
+	dataDir := db.Dir()
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		return artifacts[i].Path != dataDir && artifacts[j].Path == dataDir
+	})
+	return artifacts
+}
+
+// Verify will check each artifact against what was recorded when pb created it
+// and set its status.
+func Verify(artifacts []Artifact) []Artifact {
+	for i, artf := range artifacts {
+		if !exists(artf) {
+			artifacts[i].Status = StatusMissing
+		} else if !artf.Ephemeral && kindOf(artf.Path) != artf.Kind {
+			artifacts[i].Status = StatusModified
+		} else if hash(artf.Kind, artf.Path) != artf.Hash {
+			artifacts[i].Status = StatusModified
+		} else {
+			artifacts[i].Status = StatusOK
+		}
+	}
+	return artifacts
+}
+
+// Clean will remove the artifact from disk and then from the list. The
+// directory that the data is saved in is only emptied of this save so that
+// other slots are kept, the list goes along with the save so it is not updated.
+func Clean(db *pstore.DB, artf Artifact) error {
+	if !artf.Allowed {
+		return fmt.Errorf("refusing to remove %v", artf.Path)
+	} else if dir := db.Dir(); dir != "" && artf.Path == dir {
+		location := db.Location()
+		for _, path := range []string{location, location + ".lock"} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		os.Remove(artf.Path)
+		return nil
+	} else if artf.Ephemeral {
+		if err := Stop(artf); err != nil {
+			return err
+		}
+		Remove(db, artf.Path)
+		return nil
+	} else if err := os.RemoveAll(artf.Path); err != nil {
+		return err
+	}
+	Remove(db, artf.Path)
+	return nil
+}
+
+// manifest moves the list of paths from before the manifest into it. There is
+// no way to know how they were created so they are recorded as they are now.
+func manifest(data map[string]string) {
+	listKey := pstore.Key(pstore.ArtifactsNS, "list")
+	paths := []string{}
+	json.Unmarshal([]byte(data[listKey]), &paths)
+	artifacts := []Artifact{}
+	for _, path := range paths {
+		kind := kindOf(path)
+		artifacts = append(artifacts, Artifact{Kind: kind, Path: path, Hash: hash(kind, path), Created: time.Now().UTC()})
+	}
+	raw, _ := json.Marshal(artifacts)
+	data[pstore.Key(pstore.ArtifactsNS, "manifest")] = string(raw)
+	delete(data, listKey)
+}
+
+func exists(artf Artifact) bool {
+	if artf.Ephemeral && !running(artf) {
+		return false
+	} else if artf.Kind == KindProcess || artf.Kind == KindSignal {
+		return true
+	} else if artf.Kind == KindPort {
+		conn, err := net.DialTimeout("tcp", artf.Path, 200*time.Millisecond)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}
+	_, err := os.Lstat(artf.Path)
+	return err == nil
+}
+
+func kindOf(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return KindFile
+	} else if info.IsDir() {
+		return KindDir
+	} else if info.Mode()&fs.ModeSocket != 0 {
+		return KindSocket
+	}
+	return KindFile
+}
+
+func hash(kind, path string) string {
+	if kind != KindFile {
+		return ""
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, file); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func size(path string) int64 {
+	var total int64
+	filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		} else if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+func within(path string, roots []string) bool {
+	path = filepath.Clean(path)
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	for _, root := range roots {
+		if rel, err := filepath.Rel(filepath.Clean(root), path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
 }
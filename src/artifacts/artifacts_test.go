@@ -0,0 +1,125 @@
+package artifacts
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tanema/pb/src/pstore"
+)
+
+func TestAdd(t *testing.T) {
+	db := pstore.NewMemory()
+	path := filepath.Join(t.TempDir(), "pb.1")
+	assert.Nil(t, os.WriteFile(path, []byte("man"), 0644))
+	Add(db, KindFile, path, "start")
+	first := get(db)[0]
+	assert.Equal(t, KindFile, first.Kind)
+	assert.Equal(t, "start", first.Stage)
+	assert.Len(t, first.Hash, 64)
+
+	assert.Nil(t, os.WriteFile(path, []byte("new man"), 0644))
+	Add(db, KindFile, path, "lisp")
+	artifacts := get(db)
+	assert.Len(t, artifacts, 1)
+	assert.Equal(t, "start", artifacts[0].Stage)
+	assert.Equal(t, first.Created, artifacts[0].Created)
+	assert.NotEqual(t, first.Hash, artifacts[0].Hash)
+}
+
+func TestVerify(t *testing.T) {
+	db := pstore.NewMemory()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pb.1")
+	gone := filepath.Join(dir, "gone")
+	assert.Nil(t, os.WriteFile(file, []byte("man"), 0644))
+	assert.Nil(t, os.WriteFile(gone, []byte("gone"), 0644))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	Add(db, KindDir, dir, "")
+	Add(db, KindFile, file, "start")
+	Add(db, KindFile, gone, "start")
+	Track(db, KindPort, listener.Addr().String(), "waitforinfo")
+
+	statuses := func() []string {
+		list := []string{}
+		for _, artf := range Verify(List(db)) {
+			list = append(list, artf.Status)
+		}
+		return list
+	}
+	assert.Equal(t, []string{StatusOK, StatusOK, StatusOK, StatusOK}, statuses())
+	assert.Nil(t, os.WriteFile(file, []byte("edited"), 0644))
+	assert.Nil(t, os.Remove(gone))
+	listener.Close()
+	assert.Equal(t, []string{StatusOK, StatusModified, StatusMissing, StatusMissing}, statuses())
+}
+
+func TestTrack(t *testing.T) {
+	db := pstore.NewMemory()
+	release := Track(db, KindPort, "127.0.0.1:2023", "waitforinfo")
+	live := Live(db)
+	assert.Len(t, live, 1)
+	assert.Equal(t, os.Getpid(), live[0].PID)
+	assert.NotNil(t, Stop(live[0]))
+
+	buf := &bytes.Buffer{}
+	Print(buf, db)
+	assert.Empty(t, buf.String())
+
+	release()
+	assert.Empty(t, Live(db))
+
+	db.Namespace(pstore.ArtifactsNS).SetJSON("manifest", []Artifact{{Kind: KindPort, Path: "127.0.0.1:2023", Ephemeral: true, PID: -1}})
+	Prune(db)
+	assert.Empty(t, get(db))
+}
+
+func TestMigrateManifest(t *testing.T) {
+	dir := t.TempDir()
+	store := pstore.NewMemoryStore()
+	store.Update(func(data map[string]string) {
+		data["artifacts"] = dir + ";/does/not/exist"
+	})
+	db, err := pstore.New(store)
+	assert.Nil(t, err)
+	assert.False(t, db.Namespace(pstore.ArtifactsNS).Key("list"))
+	artifacts := get(db)
+	assert.Len(t, artifacts, 2)
+	assert.Equal(t, Artifact{Kind: KindDir, Path: dir, Created: artifacts[0].Created}, artifacts[0])
+	assert.Equal(t, KindFile, artifacts[1].Kind)
+}
+
+func TestSetup(t *testing.T) {
+	home := t.TempDir()
+	store, err := pstore.Select(pstore.Options{Home: home, AppName: "pb", Filename: ".data"})
+	assert.Nil(t, err)
+	db, err := pstore.New(store)
+	assert.Nil(t, err)
+	Setup(db)
+	dir := filepath.Join(home, ".config", "pb")
+	assert.Equal(t, []string{dir}, paths(List(db, dir)))
+	assert.Nil(t, Clean(db, List(db, dir)[0]))
+	assert.NoDirExists(t, dir)
+
+	store, err = pstore.Select(pstore.Options{Path: filepath.Join(home, "save")})
+	assert.Nil(t, err)
+	db, err = pstore.New(store)
+	assert.Nil(t, err)
+	Setup(db)
+	assert.Empty(t, List(db, db.Dir()))
+	assert.FileExists(t, db.Location())
+}
+
+func paths(artifacts []Artifact) []string {
+	list := []string{}
+	for _, artf := range artifacts {
+		list = append(list, artf.Path)
+	}
+	return list
+}
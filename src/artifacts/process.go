@@ -0,0 +1,55 @@
+//go:build !windows
+// +build !windows
+
+package artifacts
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// alive will check if the process is still running by sending it signal 0
+func alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	return err == nil && process.Signal(syscall.Signal(0)) == nil
+}
+
+// started will return when the process started, from /proc where there is one
+// or from ps where there is not. It is empty if the process can't be found.
+func started(pid int) string {
+	if pid <= 0 {
+		return ""
+	} else if stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat"); err == nil {
+		// the command can have spaces and parens in it, the fields after it do not
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		if len(fields) > 19 {
+			return fields[19]
+		}
+		return ""
+	} else if _, err := os.Stat("/proc/self/stat"); err == nil {
+		return ""
+	}
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// stop will send the process SIGTERM so that it can shut down cleanly
+func stop(pid int) error {
+	if pid <= 0 {
+		return os.ErrProcessDone
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(syscall.SIGTERM)
+}
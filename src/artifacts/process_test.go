@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package artifacts
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tanema/pb/src/pstore"
+)
+
+func TestReusedPID(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	assert.Nil(t, cmd.Start())
+	defer cmd.Process.Kill()
+	pid := cmd.Process.Pid
+	assert.NotEmpty(t, started(pid))
+
+	db := pstore.NewMemory()
+	reused := Artifact{Kind: KindPort, Path: "127.0.0.1:2023", Ephemeral: true, PID: pid, Started: "1"}
+	db.Namespace(pstore.ArtifactsNS).SetJSON("manifest", []Artifact{reused})
+	assert.Empty(t, Live(db))
+	assert.Nil(t, Stop(reused))
+	assert.True(t, alive(pid))
+
+	held := Artifact{Kind: KindPort, Path: "127.0.0.1:2023", Ephemeral: true, PID: pid, Started: started(pid)}
+	db.Namespace(pstore.ArtifactsNS).SetJSON("manifest", []Artifact{held})
+	assert.Len(t, Live(db), 1)
+	assert.Nil(t, Stop(held))
+	assert.NotNil(t, cmd.Wait())
+}
@@ -0,0 +1,50 @@
+package artifacts
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// alive will check if the process is still running, on windows finding the
+// process fails if it has exited.
+func alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err == nil {
+		process.Release()
+	}
+	return err == nil
+}
+
+// started will return when the process was created, it is empty if the process
+// can't be found.
+func started(pid int) string {
+	if pid <= 0 {
+		return ""
+	}
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(handle)
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return ""
+	}
+	return strconv.FormatInt(creation.Nanoseconds(), 10)
+}
+
+// stop will kill the process as windows cannot send it a signal
+func stop(pid int) error {
+	if pid <= 0 {
+		return os.ErrProcessDone
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/tanema/pb/src/pstore"
+)
+
+// ErrDamaged is returned when an exported save can not be read
+var ErrDamaged = errors.New("the save is damaged")
+
+// encodedBundle only has a checksum so that a save that was cut short or mangled
+// while it was copied is not imported. pb is open source so there is no secret
+// that a signature could be made with, anyone can make a bundle and whoever
+// imports one has to check what is in it.
+type encodedBundle struct {
+	Bundle   json.RawMessage `json:"bundle"`
+	Checksum string          `json:"sum"`
+}
+
+// EncodeBundle will encode the bundle so that it can be copied to another
+// machine and imported with DecodeBundle
+func EncodeBundle(bundle *pstore.Bundle) (string, error) {
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := json.Marshal(encodedBundle{
+		Bundle:   data,
+		Checksum: base64.RawURLEncoding.EncodeToString(checksum(data)),
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encoded), nil
+}
+
+// DecodeBundle will decode a bundle created with EncodeBundle, it will return
+// ErrDamaged if it can not be read. The bundle is not trusted, it could have been
+// made by anyone.
+func DecodeBundle(encoded string) (*pstore.Bundle, error) {
+	decoded := encodedBundle{}
+	bundle := &pstore.Bundle{}
+	if data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded)); err != nil {
+		return nil, ErrDamaged
+	} else if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, ErrDamaged
+	} else if sum, err := base64.RawURLEncoding.DecodeString(decoded.Checksum); err != nil {
+		return nil, ErrDamaged
+	} else if !bytes.Equal(sum, checksum(decoded.Bundle)) {
+		return nil, ErrDamaged
+	} else if err := json.Unmarshal(decoded.Bundle, bundle); err != nil {
+		return nil, ErrDamaged
+	}
+	return bundle, nil
+}
+
+func checksum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
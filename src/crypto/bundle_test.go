@@ -0,0 +1,31 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tanema/pb/src/pstore"
+)
+
+func TestBundle(t *testing.T) {
+	bundle := &pstore.Bundle{Version: 1, Data: map[string]string{"stage/stage": "lisp"}}
+	encoded, err := EncodeBundle(bundle)
+	assert.Nil(t, err)
+	opened, err := DecodeBundle(encoded + "\n")
+	assert.Nil(t, err)
+	assert.Equal(t, bundle, opened)
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	assert.Nil(t, err)
+	_, err = DecodeBundle(base64.StdEncoding.EncodeToString(raw[:len(raw)-8]))
+	assert.ErrorIs(t, err, ErrDamaged)
+	edited := strings.Replace(string(raw), "lisp", "next", 1)
+	_, err = DecodeBundle(base64.StdEncoding.EncodeToString([]byte(edited)))
+	assert.ErrorIs(t, err, ErrDamaged)
+
+	_, err = DecodeBundle("not a save")
+	assert.ErrorIs(t, err, ErrDamaged)
+}
@@ -48,7 +48,7 @@ func LoadKey(db *pstore.DB) (*EncryptionKey, error) {
 
 func readKey(db *pstore.DB) (*EncryptionKey, error) {
 	key := &EncryptionKey{}
-	if data, err := util.DecodeBase64(db.Get("skeleton")); err != nil {
+	if data, err := util.DecodeBase64(db.Namespace(pstore.SystemNS).Get("skeleton")); err != nil {
 		return nil, err
 	} else if err := json.Unmarshal(data, &key); err != nil {
 		return nil, err
@@ -65,7 +65,7 @@ func writeKey(db *pstore.DB, key *EncryptionKey) error {
 	if err != nil {
 		return err
 	}
-	return db.Set("skeleton", util.Base64(string(buf)))
+	return db.Namespace(pstore.SystemNS).Set("skeleton", util.Base64(string(buf)))
 }
 
 func randomNBytes(size int) []byte {
@@ -0,0 +1,50 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// DeriveKey will derive a save key from the secret so that the same secret will
+// always produce the same key.
+func DeriveKey(secret []byte) (*EncryptionKey, error) {
+	rawKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, []byte("pb"), []byte("pstore")), rawKey); err != nil {
+		return nil, err
+	}
+	return &EncryptionKey{
+		KID:    "save-key",
+		Enc:    "A256GCM",
+		EncKey: base64.RawURLEncoding.EncodeToString(rawKey),
+		RawKey: rawKey,
+	}, nil
+}
+
+// MachineSecret will return a secret bound to this machine and user. Anyone on
+// the machine could work it out, it is only meant to stop the save from being
+// read or edited without pb.
+func MachineSecret(home string) []byte {
+	machineID, _ := os.ReadFile("/etc/machine-id")
+	return []byte(strings.Join([]string{
+		strings.TrimSpace(string(machineID)),
+		strconv.Itoa(os.Getuid()),
+		home,
+	}, "\x00"))
+}
+
+// Seal will encrypt the plaintext, the GCM tag authenticates the data so that
+// any edits will fail to Open.
+func (key *EncryptionKey) Seal(plaintext []byte) ([]byte, error) {
+	return key.Encrypt(plaintext)
+}
+
+// Open will decrypt sealed data and fail if it has been changed
+func (key *EncryptionKey) Open(sealed []byte) ([]byte, error) {
+	return key.Decrypt(sealed)
+}
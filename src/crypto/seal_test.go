@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tanema/pb/src/pstore"
+)
+
+func TestDeriveKey(t *testing.T) {
+	key, err := DeriveKey([]byte("secret"))
+	assert.Nil(t, err)
+	again, err := DeriveKey([]byte("secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, key.RawKey, again.RawKey)
+	other, err := DeriveKey([]byte("other"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, key.RawKey, other.RawKey)
+}
+
+func TestSealedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".data")
+	key, err := DeriveKey([]byte("secret"))
+	assert.Nil(t, err)
+
+	db, err := pstore.New(pstore.NewFileStore(path, key))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Namespace(pstore.StageNS).Set("stage", "lisp"))
+
+	raw, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(raw), "lisp")
+
+	db, err = pstore.New(pstore.NewFileStore(path, key))
+	assert.Nil(t, err)
+	assert.Equal(t, "lisp", db.Namespace(pstore.StageNS).Get("stage"))
+
+	other, err := DeriveKey([]byte("other"))
+	assert.Nil(t, err)
+	_, err = pstore.New(pstore.NewFileStore(path, other))
+	assert.ErrorIs(t, err, pstore.ErrTampered)
+
+	assert.True(t, strings.HasPrefix(string(raw), "sealed:"))
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(raw), "sealed:"))
+	assert.Nil(t, err)
+	msg := map[string]string{}
+	assert.Nil(t, json.Unmarshal(sealed, &msg))
+	msg["data"] = "A" + msg["data"][1:]
+	if msg["data"][0] == 'A' {
+		msg["data"] = "B" + msg["data"][1:]
+	}
+	sealed, _ = json.Marshal(msg)
+	assert.Nil(t, os.WriteFile(path, []byte("sealed:"+base64.StdEncoding.EncodeToString(sealed)), 0o600))
+	_, err = pstore.New(pstore.NewFileStore(path, key))
+	assert.ErrorIs(t, err, pstore.ErrTampered)
+}
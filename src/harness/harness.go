@@ -0,0 +1,235 @@
+package harness
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/tanema/pb/src/pstore"
+	"github.com/tanema/pb/src/stages"
+	"github.com/tanema/pb/src/term"
+)
+
+type (
+	// Harness runs pb in process. Every run shares the same environment and
+	// in-memory DB so that a series of runs acts like a player working their way
+	// through the puzzle box. Anything started in the background listens on Addr,
+	// a free port, rather than the port the player is told about.
+	Harness struct {
+		Name  string
+		Addr  string
+		Env   map[string]string
+		DB    *pstore.DB
+		IsTTY bool
+	}
+	// Result is the captured output of a single run of pb
+	Result struct {
+		Stdout string
+		Stderr string
+		Status int
+	}
+	// Process is a run of pb happening in the background, like a listening server
+	Process struct {
+		done    chan int
+		signals chan os.Signal
+		stdout  *buffer
+		stderr  *buffer
+	}
+	// buffer is a bytes.Buffer that can be written to from server goroutines
+	// while being read by the test
+	buffer struct {
+		mx  sync.Mutex
+		buf bytes.Buffer
+	}
+)
+
+// New will create a harness that uses dir as the player's home directory and
+// as the place that the manpage is installed to.
+func New(dir string) *Harness {
+	manDir := filepath.Join(dir, "man")
+	os.MkdirAll(manDir, 0755)
+	return &Harness{
+		Name: "pb",
+		Addr: freeAddr(),
+		Env: map[string]string{
+			"USER":       "player",
+			"HOME":       dir,
+			"PB_MAN_DIR": manDir,
+		},
+		DB: pstore.NewMemory(),
+	}
+}
+
+// Stage will return the ID of the stage that the player is currently on
+func (h *Harness) Stage() string {
+	return h.DB.Namespace(pstore.StageNS).Get("stage")
+}
+
+// Run will run pb with the args and wait for it to finish
+func (h *Harness) Run(args ...string) Result {
+	return h.Exec(term.Config{Args: args})
+}
+
+// Pipe will run pb with the args and the stdin piped into it
+func (h *Harness) Pipe(stdin string, args ...string) Result {
+	return h.Exec(term.Config{Args: args, Stdin: strings.NewReader(stdin)})
+}
+
+// Exec will run pb with the config, anything not set in the config will be
+// filled in by the harness.
+func (h *Harness) Exec(cfg term.Config) Result {
+	return h.start(cfg).Wait()
+}
+
+// Start will run pb with the args in the background, listening on the
+// harness's address
+func (h *Harness) Start(args ...string) *Process {
+	env := map[string]string{"PB_LISTEN_ADDR": h.Addr}
+	for key, val := range h.Env {
+		env[key] = val
+	}
+	return h.start(term.Config{Args: args, Env: env})
+}
+
+func (h *Harness) start(cfg term.Config) *Process {
+	proc := &Process{
+		done:    make(chan int, 1),
+		signals: make(chan os.Signal, 1),
+		stdout:  &buffer{},
+		stderr:  &buffer{},
+	}
+	if cfg.Name == "" {
+		cfg.Name = h.Name
+	}
+	if cfg.Env == nil {
+		cfg.Env = h.Env
+	}
+	if cfg.DB == nil {
+		cfg.DB = h.DB
+	}
+	cfg.IsTTY, cfg.ErrTTY = h.IsTTY, h.IsTTY
+	cfg.Signals = proc.signals
+	cfg.Stdout = proc.stdout
+	cfg.Stderr = proc.stderr
+	go func() {
+		in, err := term.NewInput(cfg)
+		if err != nil {
+			io.WriteString(proc.stderr, err.Error())
+			proc.done <- 1
+			return
+		}
+		proc.done <- stages.Main(in)
+	}()
+	return proc
+}
+
+// Signal will send the signal to the process, instead of the test process
+func (proc *Process) Signal(sig os.Signal) error {
+	select {
+	case proc.signals <- sig:
+		return nil
+	case <-time.After(time.Second):
+		return errors.New("the process is not handling signals")
+	}
+}
+
+// Wait will wait for the process to finish and return its output
+func (proc *Process) Wait() Result {
+	status := <-proc.done
+	return Result{
+		Stdout: proc.stdout.String(),
+		Stderr: proc.stderr.String(),
+		Status: status,
+	}
+}
+
+// freeAddr will find a port that nothing is listening on
+func freeAddr() string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "127.0.0.1:0"
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// WaitForPort will wait until something is listening at the address
+func WaitForPort(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			return conn.Close()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return errors.New("timed out waiting for " + addr)
+}
+
+// SSH will open an ssh session with the address and send each of the lines to
+// it. It will return everything that the server has written once the server
+// ends the session, or after a second with no output.
+func SSH(addr string, lines ...string) (string, error) {
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "player",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	ch, reqs, err := client.OpenChannel("session", nil)
+	if err != nil {
+		return "", err
+	}
+	go ssh.DiscardRequests(reqs)
+	if _, err := ch.SendRequest("shell", true, nil); err != nil {
+		return "", err
+	}
+
+	out := &buffer{}
+	done := make(chan struct{})
+	go func() {
+		io.Copy(out, ch)
+		close(done)
+	}()
+	for _, line := range lines {
+		if _, err := io.WriteString(ch, line+"\r"); err != nil {
+			break
+		}
+	}
+	for size := -1; size != out.Len(); {
+		size = out.Len()
+		select {
+		case <-done:
+			return out.String(), nil
+		case <-time.After(time.Second):
+		}
+	}
+	return out.String(), nil
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *buffer) String() string {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.buf.String()
+}
+
+func (b *buffer) Len() int {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.buf.Len()
+}
@@ -0,0 +1,240 @@
+package harness
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tanema/pb/src/pstore"
+	"github.com/tanema/pb/src/term"
+)
+
+// scenario is the state of a scenario being played
+type scenario struct {
+	h          *Harness
+	out        strings.Builder
+	stdin      *string
+	quiet      bool
+	lastStdout string
+	background *Process
+	sshLines   []string
+}
+
+// Play will replay a scenario against the harness and return a transcript of
+// everything pb output with the ANSI escape codes removed. A scenario has one
+// command per line, blank lines and lines starting with # are ignored.
+//
+//	stage ID          set the player's current stage
+//	run [ARGS]        run pb with the args
+//	as NAME [ARGS]    run pb invoked with a different name
+//	lisp SOURCE       pipe the rest of the line into pb
+//	stdin TEXT        pipe the rest of the line into the next run
+//	stdin-last        pipe the output of the previous run into the next run
+//	quiet             do not record the output of the next run
+//	start [ARGS]      run pb in the background and wait for it to listen
+//	ssh LINE          send a line over ssh, consecutive lines share a session
+//	http METHOD PATH  send an http request to the background server
+//	signal SIGNAL     send a signal to the background process
+//	wait              wait for the background process to finish
+func (h *Harness) Play(script io.Reader) (string, error) {
+	sc := &scenario{h: h}
+	scanner := bufio.NewScanner(script)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cmd, rest, _ := strings.Cut(line, " ")
+		if cmd != "ssh" {
+			if err := sc.flushSSH(); err != nil {
+				return sc.out.String(), err
+			}
+		}
+		if cmd != "stage" && cmd != "stdin" && cmd != "stdin-last" && cmd != "quiet" && cmd != "ssh" {
+			fmt.Fprintf(&sc.out, "$ %v\n", line)
+		}
+		if err := sc.exec(cmd, rest); err != nil {
+			return sc.out.String(), fmt.Errorf("line %v: %w", lineNum, err)
+		}
+	}
+	if err := sc.flushSSH(); err != nil {
+		return sc.out.String(), err
+	}
+	return sc.out.String(), scanner.Err()
+}
+
+func (sc *scenario) exec(cmd, rest string) error {
+	switch cmd {
+	case "stage":
+		return sc.h.DB.Namespace(pstore.StageNS).Set("stage", rest)
+	case "run":
+		sc.run(term.Config{Args: splitArgs(rest)})
+	case "as":
+		args := splitArgs(rest)
+		if len(args) == 0 {
+			return fmt.Errorf("as requires a name")
+		}
+		sc.run(term.Config{Name: args[0], Args: args[1:]})
+	case "lisp":
+		sc.stdin = &rest
+		sc.run(term.Config{})
+	case "stdin":
+		text := strings.ReplaceAll(rest, `\n`, "\n")
+		sc.stdin = &text
+	case "stdin-last":
+		sc.stdin = &sc.lastStdout
+	case "quiet":
+		sc.quiet = true
+	case "start":
+		if sc.background != nil {
+			return fmt.Errorf("a process is already running in the background")
+		}
+		sc.background = sc.h.Start(splitArgs(rest)...)
+		return WaitForPort(sc.h.Addr, 5*time.Second)
+	case "ssh":
+		sc.sshLines = append(sc.sshLines, rest)
+	case "http":
+		return sc.http(splitArgs(rest))
+	case "signal":
+		return sc.signal(rest)
+	case "wait":
+		if sc.background == nil {
+			return fmt.Errorf("nothing is running in the background")
+		}
+		sc.record(sc.background.Wait())
+		sc.background = nil
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	return nil
+}
+
+func (sc *scenario) run(cfg term.Config) {
+	if sc.stdin != nil {
+		cfg.Stdin = strings.NewReader(*sc.stdin)
+		sc.stdin = nil
+	}
+	sc.record(sc.h.Exec(cfg))
+}
+
+func (sc *scenario) record(res Result) {
+	sc.lastStdout = res.Stdout
+	if sc.quiet {
+		sc.quiet = false
+		res.Stdout = ""
+	}
+	sc.write(res.Stdout)
+	sc.write(res.Stderr)
+	if res.Status != 0 {
+		fmt.Fprintf(&sc.out, "[exit %v]\n", res.Status)
+	}
+}
+
+func (sc *scenario) write(output string) {
+	output = strings.ReplaceAll(term.StripANSI(output), "\r", "")
+	if output == "" {
+		return
+	}
+	sc.out.WriteString(output)
+	if !strings.HasSuffix(output, "\n") {
+		sc.out.WriteString("\n")
+	}
+}
+
+func (sc *scenario) flushSSH() error {
+	if len(sc.sshLines) == 0 {
+		return nil
+	}
+	for _, line := range sc.sshLines {
+		fmt.Fprintf(&sc.out, "$ ssh %v\n", line)
+	}
+	output, err := SSH(sc.h.Addr, sc.sshLines...)
+	sc.sshLines = nil
+	sc.write(output)
+	return err
+}
+
+func (sc *scenario) http(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("http requires a method and a path")
+	}
+	req, err := http.NewRequest(args[0], "http://"+sc.h.Addr+args[1], nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(&sc.out, "%v\n", resp.Status)
+	sc.write(string(body))
+	return nil
+}
+
+func (sc *scenario) signal(name string) error {
+	if sc.background == nil {
+		return fmt.Errorf("nothing is running in the background")
+	}
+	num, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		var err error
+		if num, err = strconv.Atoi(name); err != nil {
+			return fmt.Errorf("unknown signal %q", name)
+		}
+	}
+	size := sc.background.stdout.Len()
+	if err := sc.background.Signal(syscall.Signal(num)); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if sc.background.stdout.Len() != size {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// splitArgs will split a line into args the same way a shell would, keeping
+// quoted strings together.
+func splitArgs(line string) []string {
+	args := []string{}
+	var current strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package harness
+
+import "syscall"
+
+// signals are the names that a scenario can use to send signals, INFO is the
+// number that the wait stage listens on.
+var signals = map[string]int{
+	"HUP":  int(syscall.SIGHUP),
+	"INT":  int(syscall.SIGINT),
+	"TERM": int(syscall.SIGTERM),
+	"USR1": int(syscall.SIGUSR1),
+	"USR2": int(syscall.SIGUSR2),
+	"INFO": 29,
+}
@@ -15,6 +15,10 @@ type (
 	symbol string
 )
 
+// Stdout is the symbol that print and env will write their output to if it is
+// bound to an io.Writer, otherwise they will write to os.Stdout
+const Stdout = "*standard-output*"
+
 var (
 	numberPattern = regexp.MustCompile(`^-?[0-9]+\.?[0-9]*$|^-?\.[0-9]+$`)
 	tokensPattern = regexp.MustCompile(
@@ -182,10 +186,17 @@ Usage: (env)`, nil
 		output = append(output, k)
 	}
 	sort.Strings(output)
-	fmt.Println(output)
+	fmt.Fprintln(stdout(env), output)
 	return nil, nil
 }
 
+func stdout(env map[string]any) io.Writer {
+	if w, ok := env[Stdout].(io.Writer); ok {
+		return w
+	}
+	return os.Stdout
+}
+
 func IsDocCall(env map[string]any, args []any) bool {
 	return env == nil && args == nil
 }
@@ -316,7 +327,7 @@ Example: (print "hello" " " "world")`, nil
 	}
 	str, err := str(env, args)
 	if err == nil {
-		fmt.Println(str)
+		fmt.Fprintln(stdout(env), str)
 	}
 	return nil, err
 }
@@ -0,0 +1,78 @@
+package pstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Bundle is a copy of some of the namespaces in a DB that can be moved to
+// another DB, keeping the schema version it was exported with so that it can be
+// migrated when it is imported.
+type Bundle struct {
+	Version int               `json:"version"`
+	Data    map[string]string `json:"data"`
+}
+
+// Export will copy all of the keys in the namespaces into a bundle
+func (db *DB) Export(namespaces ...string) *Bundle {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+	version, _ := strconv.Atoi(db.data[versionKey])
+	bundle := &Bundle{Version: version, Data: map[string]string{}}
+	for key, val := range db.data {
+		if inNamespaces(key, namespaces) {
+			bundle.Data[key] = val
+		}
+	}
+	return bundle
+}
+
+// Migrate will bring the bundle up to the current schema version, so that its
+// keys can be checked before it is imported
+func (bundle *Bundle) Migrate() error {
+	if bundle.Version > SchemaVersion() {
+		return fmt.Errorf("data is from a newer version (%v)", bundle.Version)
+	}
+	data := map[string]string{versionKey: strconv.Itoa(bundle.Version)}
+	for key, val := range bundle.Data {
+		data[key] = val
+	}
+	migrate(data)
+	bundle.Version, _ = strconv.Atoi(data[versionKey])
+	delete(data, versionKey)
+	bundle.Data = data
+	return nil
+}
+
+// Import will migrate the bundle to the current schema version and replace the
+// keys in the namespaces with the ones in the bundle. Keys in the bundle outside
+// of the namespaces are ignored.
+func (db *DB) Import(bundle *Bundle, namespaces ...string) error {
+	if err := bundle.Migrate(); err != nil {
+		return err
+	}
+	db.mx.Lock()
+	defer db.mx.Unlock()
+	return db.update(func(data map[string]string) {
+		for key := range data {
+			if inNamespaces(key, namespaces) {
+				delete(data, key)
+			}
+		}
+		for key, val := range bundle.Data {
+			if inNamespaces(key, namespaces) {
+				data[key] = val
+			}
+		}
+	})
+}
+
+func inNamespaces(key string, namespaces []string) bool {
+	for _, name := range namespaces {
+		if strings.HasPrefix(key, name+separator) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package pstore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	db := NewMemory()
+	assert.Nil(t, db.Namespace(StageNS).Set("stage", "lisp"))
+	assert.Nil(t, db.Namespace(SystemNS).Set("skeleton", "key"))
+	bundle := db.Export(StageNS)
+	assert.Equal(t, SchemaVersion(), bundle.Version)
+	assert.Equal(t, map[string]string{"stage/stage": "lisp"}, bundle.Data)
+
+	other := NewMemory()
+	assert.Nil(t, other.Namespace(StageNS).Set("candyman", "3"))
+	assert.Nil(t, other.Import(bundle, StageNS))
+	assert.Equal(t, "lisp", other.Namespace(StageNS).Get("stage"))
+	assert.False(t, other.Namespace(StageNS).Key("candyman"))
+	assert.False(t, other.Namespace(SystemNS).Key("skeleton"))
+
+	legacy := &Bundle{Data: map[string]string{"stage": "merrygoround", "skeleton": "key"}}
+	assert.Nil(t, other.Import(legacy, StageNS))
+	assert.Equal(t, "merrygoround", other.Namespace(StageNS).Get("stage"))
+	assert.False(t, other.Namespace(SystemNS).Key("skeleton"))
+
+	newer := SchemaVersion() + 1
+	assert.EqualError(t, other.Import(&Bundle{Version: newer}, StageNS), fmt.Sprintf("data is from a newer version (%v)", newer))
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package pstore
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile will take an exclusive advisory lock on the file at the path,
+// waiting for any other process holding it. The returned func releases it.
+func lockFile(path string) (func() error, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() error {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		return file.Close()
+	}, nil
+}
@@ -0,0 +1,7 @@
+package pstore
+
+// lockFile is a no-op on windows where the data is only guarded by the rename
+// of the data file.
+func lockFile(path string) (func() error, error) {
+	return func() error { return nil }, nil
+}
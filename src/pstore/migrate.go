@@ -0,0 +1,103 @@
+package pstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Migration will upgrade data saved with an older schema version to the
+// version that it was registered with.
+type Migration func(data map[string]string)
+
+const versionKey = SystemNS + separator + "version"
+
+var (
+	migrationsMx sync.Mutex
+	migrations   = map[int]Migration{}
+)
+
+func init() {
+	RegisterMigration(1, namespaceKeys)
+}
+
+// RegisterMigration will add a migration that upgrades data to the version.
+// When a DB is opened, every migration newer than the version the data was
+// saved with is run in order. It will panic if the version is already taken.
+func RegisterMigration(version int, migration Migration) {
+	migrationsMx.Lock()
+	defer migrationsMx.Unlock()
+	if _, ok := migrations[version]; ok {
+		panic(fmt.Sprintf("pstore: migration %v registered twice", version))
+	}
+	migrations[version] = migration
+}
+
+// SchemaVersion will return the version that data is saved with, which is the
+// newest registered migration.
+func SchemaVersion() int {
+	migrationsMx.Lock()
+	defer migrationsMx.Unlock()
+	latest := 0
+	for version := range migrations {
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest
+}
+
+// Version will return the schema version that the data was saved with
+func (db *DB) Version() int {
+	version, _ := strconv.Atoi(db.Get(versionKey))
+	return version
+}
+
+// migrate will run all the migrations needed to bring the data up to date
+func migrate(data map[string]string) {
+	current, _ := strconv.Atoi(data[versionKey])
+	migrationsMx.Lock()
+	versions := []int{}
+	for version := range migrations {
+		if version > current {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	for _, version := range versions {
+		migrations[version](data)
+		data[versionKey] = strconv.Itoa(version)
+	}
+	migrationsMx.Unlock()
+}
+
+// namespaceKeys moves the flat keys from before namespaces into their
+// namespaces. The artifacts list was joined with ; and the candyman counter
+// was a string that grew by one character every time.
+func namespaceKeys(data map[string]string) {
+	for key, val := range data {
+		if strings.Contains(key, separator) {
+			continue
+		}
+		delete(data, key)
+		switch key {
+		case "skeleton":
+			data[SystemNS+separator+key] = val
+		case "hint":
+		case "artifacts":
+			paths := []string{}
+			if val != "" {
+				paths = strings.Split(val, ";")
+			}
+			raw, _ := json.Marshal(paths)
+			data[ArtifactsNS+separator+"list"] = string(raw)
+		case "candyman":
+			data[StageNS+separator+key] = strconv.Itoa(len(val))
+		default:
+			data[StageNS+separator+key] = val
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package pstore
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Namespace is a group of keys in the DB that belong to a single subsystem so
+// that they can be reset without touching anyone else's keys.
+type Namespace struct {
+	db   *DB
+	name string
+}
+
+const (
+	// StageNS is where stage progress is kept
+	StageNS = "stage"
+	// SystemNS is where keys that should survive a reset are kept
+	SystemNS = "system"
+	// ArtifactsNS is where the artifacts that pb has created are kept
+	ArtifactsNS = "artifacts"
+
+	separator = "/"
+)
+
+// Namespace will return the namespace with the name
+func (db *DB) Namespace(name string) *Namespace {
+	return &Namespace{db: db, name: name}
+}
+
+func (ns *Namespace) key(key string) string {
+	return Key(ns.name, key)
+}
+
+// Key will return the key in the DB for a key in the namespace, this is what
+// migrations need to find keys in the data.
+func Key(namespace, key string) string {
+	return namespace + separator + key
+}
+
+// Get will return the value for the key. If no value, an empty string will be
+// returned
+func (ns *Namespace) Get(key string) string {
+	return ns.db.Get(ns.key(key))
+}
+
+// Set will set the value with the key in the namespace
+func (ns *Namespace) Set(key, val string) error {
+	return ns.db.Set(ns.key(key), val)
+}
+
+// Update will set the key to the value returned by fn from the latest value
+func (ns *Namespace) Update(key string, fn func(val string) string) error {
+	return ns.db.Update(ns.key(key), fn)
+}
+
+// Key will return true if the key exists in the namespace
+func (ns *Namespace) Key(key string) bool {
+	return ns.db.Key(ns.key(key))
+}
+
+// Del will remove the key/val from the namespace
+func (ns *Namespace) Del(key string) error {
+	return ns.db.Del(ns.key(key))
+}
+
+// Keys will return all of the keys in the namespace without the namespace prefix
+func (ns *Namespace) Keys() []string {
+	keys := []string{}
+	for _, key := range ns.db.Keys() {
+		if strings.HasPrefix(key, ns.name+separator) {
+			keys = append(keys, strings.TrimPrefix(key, ns.name+separator))
+		}
+	}
+	return keys
+}
+
+// Drop will remove every key in the namespace
+func (ns *Namespace) Drop() error {
+	ns.db.mx.Lock()
+	defer ns.db.mx.Unlock()
+	return ns.db.update(func(data map[string]string) {
+		for key := range data {
+			if strings.HasPrefix(key, ns.name+separator) {
+				delete(data, key)
+			}
+		}
+	})
+}
+
+// Int will return the value of the key as an int, or 0 if it is not an int
+func (ns *Namespace) Int(key string) int {
+	val, _ := strconv.Atoi(ns.Get(key))
+	return val
+}
+
+// SetInt will set the int value with the key
+func (ns *Namespace) SetInt(key string, val int) error {
+	return ns.Set(key, strconv.Itoa(val))
+}
+
+// Bool will return the value of the key as a bool, or false if it is not a bool
+func (ns *Namespace) Bool(key string) bool {
+	val, _ := strconv.ParseBool(ns.Get(key))
+	return val
+}
+
+// SetBool will set the bool value with the key
+func (ns *Namespace) SetBool(key string, val bool) error {
+	return ns.Set(key, strconv.FormatBool(val))
+}
+
+// Strings will return the value of the key as a list of strings, or an empty
+// list if it is not set
+func (ns *Namespace) Strings(key string) []string {
+	vals := []string{}
+	ns.JSON(key, &vals)
+	return vals
+}
+
+// SetStrings will set the list of strings with the key
+func (ns *Namespace) SetStrings(key string, vals []string) error {
+	return ns.SetJSON(key, vals)
+}
+
+// JSON will decode the json value of the key into v. If the key is not set, v
+// is left untouched.
+func (ns *Namespace) JSON(key string, v any) error {
+	raw := ns.Get(key)
+	if raw == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(raw), v)
+}
+
+// SetJSON will encode v as json and set it with the key
+func (ns *Namespace) SetJSON(key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ns.Set(key, string(raw))
+}
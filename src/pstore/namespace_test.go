@@ -0,0 +1,53 @@
+package pstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespace(t *testing.T) {
+	db := NewMemory()
+	stage := db.Namespace(StageNS)
+	system := db.Namespace(SystemNS)
+
+	assert.Nil(t, stage.SetInt("hints", 3))
+	assert.Equal(t, 3, stage.Int("hints"))
+	assert.Equal(t, "3", db.Get("stage/hints"))
+
+	assert.Nil(t, stage.SetBool("solved", true))
+	assert.True(t, stage.Bool("solved"))
+	assert.False(t, stage.Bool("missing"))
+
+	assert.Nil(t, stage.SetStrings("list", []string{"a", "b"}))
+	assert.Equal(t, []string{"a", "b"}, stage.Strings("list"))
+	assert.Equal(t, []string{}, stage.Strings("missing"))
+
+	assert.Nil(t, system.Set("skeleton", "key"))
+	assert.ElementsMatch(t, []string{"hints", "solved", "list"}, stage.Keys())
+
+	assert.Nil(t, stage.Drop())
+	assert.Empty(t, stage.Keys())
+	assert.Equal(t, "key", system.Get("skeleton"))
+}
+
+func TestMigrateNamespaceKeys(t *testing.T) {
+	store := NewMemoryStore()
+	store.Update(func(data map[string]string) {
+		data["stage"] = "lisp"
+		data["hints"] = "2"
+		data["candyman"] = "111"
+		data["skeleton"] = "key"
+		data["hint"] = "are you trying to cheat by looking at the data?"
+		data["artifacts"] = "/a;/b"
+	})
+	db, err := New(store)
+	assert.Nil(t, err)
+	assert.Equal(t, SchemaVersion(), db.Version())
+	assert.Equal(t, "lisp", db.Namespace(StageNS).Get("stage"))
+	assert.Equal(t, 2, db.Namespace(StageNS).Int("hints"))
+	assert.Equal(t, 3, db.Namespace(StageNS).Int("candyman"))
+	assert.Equal(t, "key", db.Namespace(SystemNS).Get("skeleton"))
+	assert.Equal(t, []string{"/a", "/b"}, db.Namespace(ArtifactsNS).Strings("list"))
+	assert.False(t, db.Key("hint"))
+}
@@ -1,61 +1,58 @@
 package pstore
 
 import (
-	"encoding/base64"
-	"encoding/json"
-	"io"
-	"os"
-	"path/filepath"
+	"strconv"
 	"sync"
 )
 
-// DB is the store for data in a simple file
+// DB is a simple key value store, kept in a Store
 type DB struct {
-	filename string
-	data     map[string]string
-	mx       sync.Mutex
+	store Store
+	data  map[string]string
+	mx    sync.Mutex
 }
 
-// New will create a new file store in the user config path
-func New(appName, filename string) (*DB, error) {
-	configDir := filepath.Join(os.Getenv("HOME"), ".config", appName)
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+// New will create a DB and load its data from the store, migrating it if it
+// was saved with an older schema version.
+func New(store Store) (*DB, error) {
+	data, err := store.Load()
+	if err != nil {
 		return nil, err
 	}
-	db := &DB{
-		filename: filepath.Join(configDir, filename),
-		data:     map[string]string{},
+	if version, _ := strconv.Atoi(data[versionKey]); version < SchemaVersion() {
+		if data, err = store.Update(migrate); err != nil {
+			return nil, err
+		}
 	}
-	return db, db.read()
+	return &DB{store: store, data: data}, nil
 }
 
-func (db *DB) read() error {
-	if _, err := os.Stat(db.filename); os.IsNotExist(err) {
-		return nil
-	} else if file, err := os.Open(db.filename); err != nil {
-		return err
-	} else if byteData, err := io.ReadAll(file); err != nil {
-	} else if rawData, err := base64.StdEncoding.DecodeString(string(byteData)); err != nil {
-		return err
-	} else if string(rawData) == "" {
-		return nil
-	} else if err := json.Unmarshal(rawData, &db.data); err != nil {
-		return err
-	} else if err := file.Close(); err != nil {
-		return err
-	}
-	return nil
+// NewMemory will create a DB that is never written to disk
+func NewMemory() *DB {
+	db, _ := New(NewMemoryStore())
+	return db
 }
 
-func (db *DB) commit() error {
-	if file, err := os.OpenFile(db.filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755); err != nil {
-	} else if rawData, err := json.Marshal(db.data); err != nil {
-		return err
-	} else if _, err := file.WriteString(base64.StdEncoding.EncodeToString(rawData)); err != nil {
-		return err
-	} else if err := file.Close(); err != nil {
+// Location will return where the data is stored, if the store is not on disk
+// it will return an empty string
+func (db *DB) Location() string {
+	return db.store.Location()
+}
+
+// Dir will return the directory that pb made to keep the data in, if the data
+// is kept somewhere that the player chose it will return an empty string
+func (db *DB) Dir() string {
+	return db.store.Dir()
+}
+
+// update will apply the changes to the latest data in the store and keep the
+// result. It expects the mutex to be held.
+func (db *DB) update(changes func(map[string]string)) error {
+	data, err := db.store.Update(changes)
+	if err != nil {
 		return err
 	}
+	db.data = data
 	return nil
 }
 
@@ -90,24 +87,34 @@ func (db *DB) Keys() []string {
 func (db *DB) Set(key, val string) error {
 	db.mx.Lock()
 	defer db.mx.Unlock()
-	db.data[key] = val
-	return db.commit()
+	return db.update(func(data map[string]string) { data[key] = val })
+}
+
+// Update will set the key to the value returned by fn, which is passed the
+// latest value in the store. It should be used when the new value is built from
+// the old one so that changes made by other processes are not lost.
+func (db *DB) Update(key string, fn func(val string) string) error {
+	db.mx.Lock()
+	defer db.mx.Unlock()
+	return db.update(func(data map[string]string) { data[key] = fn(data[key]) })
 }
 
 // Del will remove the key/val from the store
 func (db *DB) Del(key string) error {
 	db.mx.Lock()
 	defer db.mx.Unlock()
-	delete(db.data, key)
-	return db.commit()
+	return db.update(func(data map[string]string) { delete(data, key) })
 }
 
 // Drop will wipe the entire store
 func (db *DB) Drop() error {
 	db.mx.Lock()
 	defer db.mx.Unlock()
-	db.data = map[string]string{}
-	return db.commit()
+	return db.update(func(data map[string]string) {
+		for key := range data {
+			delete(data, key)
+		}
+	})
 }
 
 // Dump will return all the data in the store
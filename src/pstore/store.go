@@ -0,0 +1,264 @@
+package pstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type (
+	// Store is where a DB loads its data from and saves it to. Update should
+	// load the latest data, apply the changes and save it without anyone else
+	// being able to save in between, so that concurrent processes do not clobber
+	// each other's keys. It returns the data that was saved. Dir is the
+	// directory that pb made to keep the data in, it is empty if the data is
+	// kept somewhere that the player chose.
+	Store interface {
+		Load() (map[string]string, error)
+		Update(changes func(map[string]string)) (map[string]string, error)
+		Reset() error
+		Location() string
+		Dir() string
+	}
+	// Sealer encrypts and authenticates the data before it is written to disk.
+	// Open should fail if the sealed data has been changed in any way.
+	Sealer interface {
+		Seal(plaintext []byte) ([]byte, error)
+		Open(sealed []byte) ([]byte, error)
+	}
+	// Options are used to select which store to use
+	Options struct {
+		Kind       string
+		Path       string
+		Home       string
+		ConfigHome string
+		AppName    string
+		Filename   string
+		Slot       string
+		Sealer     Sealer
+	}
+	fileStore struct {
+		path   string
+		dir    string
+		sealer Sealer
+	}
+	memoryStore struct {
+		data map[string]string
+		mx   sync.Mutex
+	}
+)
+
+// ErrTampered is returned when sealed data has been changed outside of pb
+var ErrTampered = errors.New("the data has been tampered with")
+
+// sealedPrefix marks a file as sealed so that it is never mistaken for a save
+// from before sealing
+const sealedPrefix = "sealed:"
+
+const (
+	// KindFile stores data in a file in $HOME/.config
+	KindFile = "file"
+	// KindXDG stores data in a file in $XDG_CONFIG_HOME
+	KindXDG = "xdg"
+	// KindMemory stores data in memory, this is useful for tests
+	KindMemory = "memory"
+)
+
+var slotName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Select will create the store described by the options. If a path is set the
+// data will be stored in that file no matter the kind. A slot keeps its data in
+// its own file beside the default one.
+func Select(opts Options) (Store, error) {
+	suffix := ""
+	if opts.Slot != "" && !slotName.MatchString(opts.Slot) {
+		return nil, fmt.Errorf("invalid slot name %q, only letters, numbers, - and _ are allowed", opts.Slot)
+	} else if opts.Slot != "" {
+		suffix = "." + opts.Slot
+	}
+	if opts.Path != "" {
+		return NewFileStore(opts.Path+suffix, opts.Sealer), nil
+	}
+	switch opts.Kind {
+	case "", KindFile:
+		dir := filepath.Join(opts.Home, ".config", opts.AppName)
+		return &fileStore{path: filepath.Join(dir, opts.Filename+suffix), dir: dir, sealer: opts.Sealer}, nil
+	case KindXDG:
+		configHome := opts.ConfigHome
+		if configHome == "" {
+			configHome = filepath.Join(opts.Home, ".config")
+		}
+		dir := filepath.Join(configHome, opts.AppName)
+		return &fileStore{path: filepath.Join(dir, opts.Filename+suffix), dir: dir, sealer: opts.Sealer}, nil
+	case KindMemory:
+		if opts.Slot != "" {
+			return nil, fmt.Errorf("slot %q can't be used with the %v store, it is never saved", opts.Slot, KindMemory)
+		}
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", opts.Kind)
+	}
+}
+
+// NewFileStore will create a store that keeps its data base64 encoded in the
+// file at the path. If a sealer is provided the data will be sealed before it
+// is encoded and any changes made to the file outside of pb will cause Load to
+// return ErrTampered.
+func NewFileStore(path string, sealer Sealer) Store {
+	return &fileStore{path: path, sealer: sealer}
+}
+
+func (store *fileStore) Location() string {
+	return store.path
+}
+
+func (store *fileStore) Dir() string {
+	return store.dir
+}
+
+func (store *fileStore) Load() (map[string]string, error) {
+	data := map[string]string{}
+	if byteData, err := os.ReadFile(store.path); os.IsNotExist(err) {
+		return data, nil
+	} else if err != nil {
+		return nil, err
+	} else if rawData, err := store.decode(string(byteData)); err != nil {
+		return nil, err
+	} else if len(rawData) == 0 {
+		return data, nil
+	} else if err := json.Unmarshal(rawData, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// decode will decode the file contents and open them if they were sealed. A
+// store with a sealer only accepts sealed data, saves from before sealing can
+// not be told apart from an edited save so they have to be started over with
+// --reset.
+func (store *fileStore) decode(contents string) ([]byte, error) {
+	sealed := strings.HasPrefix(contents, sealedPrefix)
+	rawData, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(contents, sealedPrefix))
+	if store.sealer == nil && sealed {
+		return nil, fmt.Errorf("%v is sealed", store.path)
+	} else if store.sealer == nil {
+		return rawData, err
+	} else if err != nil || !sealed {
+		return nil, ErrTampered
+	} else if plaintext, err := store.sealer.Open(rawData); err != nil {
+		return nil, ErrTampered
+	} else {
+		return plaintext, nil
+	}
+}
+
+// Reset will remove all the data without reading it, so that it can be used to
+// recover from tampered data.
+func (store *fileStore) Reset() error {
+	if err := os.MkdirAll(filepath.Dir(store.path), 0755); err != nil {
+		return err
+	}
+	unlock, err := lockFile(store.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return store.write(map[string]string{})
+}
+
+// Update will hold a lock on the data file while it reloads the data, applies
+// the changes and saves it. The data is written to a temp file that replaces
+// the data file so that it is never left half written.
+func (store *fileStore) Update(changes func(map[string]string)) (map[string]string, error) {
+	if err := os.MkdirAll(filepath.Dir(store.path), 0755); err != nil {
+		return nil, err
+	}
+	unlock, err := lockFile(store.path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	data, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	changes(data)
+	return data, store.write(data)
+}
+
+func (store *fileStore) write(data map[string]string) error {
+	prefix := ""
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	} else if store.sealer != nil {
+		prefix = sealedPrefix
+		if rawData, err = store.sealer.Seal(rawData); err != nil {
+			return err
+		}
+	}
+	file, err := os.CreateTemp(filepath.Dir(store.path), filepath.Base(store.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString(prefix + base64.StdEncoding.EncodeToString(rawData)); err != nil {
+		file.Close()
+		return err
+	} else if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	} else if err := file.Close(); err != nil {
+		return err
+	} else if err := os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), store.path)
+}
+
+// NewMemoryStore will create a store that is never written to disk
+func NewMemoryStore() Store {
+	return &memoryStore{data: map[string]string{}}
+}
+
+func (store *memoryStore) Location() string {
+	return ""
+}
+
+func (store *memoryStore) Dir() string {
+	return ""
+}
+
+func (store *memoryStore) Load() (map[string]string, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	return copyData(store.data), nil
+}
+
+func (store *memoryStore) Reset() error {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	store.data = map[string]string{}
+	return nil
+}
+
+func (store *memoryStore) Update(changes func(map[string]string)) (map[string]string, error) {
+	store.mx.Lock()
+	defer store.mx.Unlock()
+	changes(store.data)
+	return copyData(store.data), nil
+}
+
+func copyData(data map[string]string) map[string]string {
+	dup := make(map[string]string, len(data))
+	for key, val := range data {
+		dup[key] = val
+	}
+	return dup
+}
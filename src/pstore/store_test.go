@@ -0,0 +1,169 @@
+package pstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelect(t *testing.T) {
+	opts := Options{Home: "/home/tim", AppName: "pb", Filename: ".data"}
+	store, err := Select(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "/home/tim/.config/pb/.data", store.Location())
+
+	opts.Kind = KindXDG
+	store, err = Select(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "/home/tim/.config/pb/.data", store.Location())
+
+	opts.ConfigHome = "/xdg"
+	store, err = Select(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "/xdg/pb/.data", store.Location())
+	assert.Equal(t, "/xdg/pb", store.Dir())
+
+	opts.Path = "/tmp/save"
+	store, err = Select(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "/tmp/save", store.Location())
+	assert.Equal(t, "", store.Dir())
+
+	opts.Slot = "alice"
+	store, err = Select(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "/tmp/save.alice", store.Location())
+
+	opts.Path = ""
+	store, err = Select(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "/xdg/pb/.data.alice", store.Location())
+
+	opts.Slot = "../bob"
+	_, err = Select(opts)
+	assert.EqualError(t, err, `invalid slot name "../bob", only letters, numbers, - and _ are allowed`)
+
+	store, err = Select(Options{Kind: KindMemory})
+	assert.Nil(t, err)
+	assert.Equal(t, "", store.Location())
+	_, err = Select(Options{Kind: KindMemory, Slot: "alice"})
+	assert.EqualError(t, err, `slot "alice" can't be used with the memory store, it is never saved`)
+
+	_, err = Select(Options{Kind: "cloud"})
+	assert.EqualError(t, err, `unknown store "cloud"`)
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pb", ".data")
+	db, err := New(NewFileStore(path, nil))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Set("stage", "lisp"))
+
+	db, err = New(NewFileStore(path, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, "lisp", db.Get("stage"))
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	db, err := New(store)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Set("stage", "lisp"))
+
+	db, err = New(store)
+	assert.Nil(t, err)
+	assert.Equal(t, "lisp", db.Get("stage"))
+}
+
+func TestFileStoreConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".data")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		db, err := New(NewFileStore(path, nil))
+		assert.Nil(t, err)
+		wg.Add(1)
+		go func(i int, db *DB) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				assert.Nil(t, db.Namespace("test").Set(fmt.Sprintf("%v-%v", i, j), "set"))
+			}
+		}(i, db)
+	}
+	wg.Wait()
+
+	db, err := New(NewFileStore(path, nil))
+	assert.Nil(t, err)
+	assert.Len(t, db.Namespace("test").Keys(), 100)
+	matches, err := filepath.Glob(path + ".*.tmp")
+	assert.Nil(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestFileStoreConcurrentUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".data")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		db, err := New(NewFileStore(path, nil))
+		assert.Nil(t, err)
+		wg.Add(1)
+		go func(db *DB) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				assert.Nil(t, db.Namespace("test").Update("count", func(val string) string {
+					count, _ := strconv.Atoi(val)
+					return strconv.Itoa(count + 1)
+				}))
+			}
+		}(db)
+	}
+	wg.Wait()
+
+	db, err := New(NewFileStore(path, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, 100, db.Namespace("test").Int("count"))
+}
+
+type reverseSealer struct{}
+
+func (reverseSealer) Seal(plaintext []byte) ([]byte, error) { return reverse(plaintext), nil }
+func (reverseSealer) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) == 0 || sealed[0] != '}' {
+		return nil, fmt.Errorf("not sealed")
+	}
+	return reverse(sealed), nil
+}
+
+func reverse(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[len(data)-1-i] = b
+	}
+	return out
+}
+
+func TestSealedFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".data")
+	_, err := New(NewFileStore(path, nil))
+	assert.Nil(t, err)
+
+	store := NewFileStore(path, reverseSealer{})
+	_, err = store.Load()
+	assert.ErrorIs(t, err, ErrTampered)
+	assert.Nil(t, store.Reset())
+	db, err := New(store)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Namespace(StageNS).Set("stage", "lisp"))
+
+	data, err := NewFileStore(path, reverseSealer{}).Load()
+	assert.Nil(t, err)
+	assert.Equal(t, "lisp", data[StageNS+separator+"stage"])
+
+	unsealed := filepath.Join(t.TempDir(), ".data")
+	assert.Nil(t, NewFileStore(unsealed, nil).(*fileStore).write(map[string]string{"stage": "next"}))
+	_, err = New(NewFileStore(unsealed, reverseSealer{}))
+	assert.ErrorIs(t, err, ErrTampered)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHAuth are the ways that a player can authenticate over ssh, only the
+// methods that are set are offered. If none are set anyone can connect. The
+// method that succeeded is recorded on the Session.
+type SSHAuth struct {
+	// Password is called with the password the player entered
+	Password func(user, password string) bool
+	// AuthorizedKeys are the public keys that are let in, like an
+	// authorized_keys file
+	AuthorizedKeys []ssh.PublicKey
+	// PublicKey is called with keys that are not in AuthorizedKeys
+	PublicKey func(user string, key ssh.PublicKey) bool
+	// KeyboardInteractive can ask the player as many rounds of questions as it
+	// likes with challenge before deciding if they are let in
+	KeyboardInteractive func(user string, challenge ssh.KeyboardInteractiveChallenge) bool
+}
+
+const (
+	// AuthNone means that the server let the player in without authenticating
+	AuthNone = "none"
+	// AuthPassword means the player entered a password
+	AuthPassword = "password"
+	// AuthPublicKey means the player used a public key
+	AuthPublicKey = "publickey"
+	// AuthKeyboardInteractive means the player answered a challenge
+	AuthKeyboardInteractive = "keyboard-interactive"
+
+	authMethodExt  = "auth-method"
+	fingerprintExt = "fingerprint"
+)
+
+var errAuthFailed = errors.New("authentication failed")
+
+// ParseAuthorizedKeys will parse the keys in the authorized_keys format
+func ParseAuthorizedKeys(data []byte) ([]ssh.PublicKey, error) {
+	keys := []ssh.PublicKey{}
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		data = rest
+	}
+	return keys, nil
+}
+
+func (server *Server) sshConfig() *ssh.ServerConfig {
+	auth := server.sshAuth
+	config := &ssh.ServerConfig{
+		NoClientAuth: auth.Password == nil && auth.AuthorizedKeys == nil && auth.PublicKey == nil && auth.KeyboardInteractive == nil,
+	}
+	if auth.Password != nil {
+		config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if auth.Password(conn.User(), string(password)) {
+				return permissions(AuthPassword, ""), nil
+			}
+			return nil, errAuthFailed
+		}
+	}
+	if auth.AuthorizedKeys != nil || auth.PublicKey != nil {
+		config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if auth.authorized(key) || (auth.PublicKey != nil && auth.PublicKey(conn.User(), key)) {
+				return permissions(AuthPublicKey, ssh.FingerprintSHA256(key)), nil
+			}
+			return nil, errAuthFailed
+		}
+	}
+	if auth.KeyboardInteractive != nil {
+		config.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			if auth.KeyboardInteractive(conn.User(), challenge) {
+				return permissions(AuthKeyboardInteractive, ""), nil
+			}
+			return nil, errAuthFailed
+		}
+	}
+	pk, _ := ssh.ParsePrivateKey(key)
+	config.AddHostKey(pk)
+	return config
+}
+
+func (auth SSHAuth) authorized(key ssh.PublicKey) bool {
+	for _, authorized := range auth.AuthorizedKeys {
+		if bytes.Equal(authorized.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+func permissions(method, fingerprint string) *ssh.Permissions {
+	return &ssh.Permissions{Extensions: map[string]string{authMethodExt: method, fingerprintExt: fingerprint}}
+}
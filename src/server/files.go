@@ -0,0 +1,59 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+)
+
+type (
+	// FileSystem is what players can copy files to and from over sftp and scp.
+	// Paths are always absolute, relative paths are resolved from Home.
+	FileSystem interface {
+		Home(sess *Session) string
+		Stat(sess *Session, name string) (fs.FileInfo, error)
+		ReadDir(sess *Session, name string) ([]fs.FileInfo, error)
+		ReadFile(sess *Session, name string) ([]byte, error)
+		WriteFile(sess *Session, name string, data []byte, perm fs.FileMode) error
+	}
+	// Transfer is a file that was copied over sftp or scp. Upload is true if
+	// the player sent the file and Err is set if it failed.
+	Transfer struct {
+		Session  *Session
+		Protocol string
+		Upload   bool
+		Path     string
+		Size     int
+		Err      error
+	}
+)
+
+const (
+	// ProtocolSFTP is a transfer over the sftp subsystem
+	ProtocolSFTP = "sftp"
+	// ProtocolSCP is a transfer with the legacy scp protocol
+	ProtocolSCP = "scp"
+)
+
+var errNotDir = errors.New("not a directory")
+
+// HandleFiles will let players copy files to and from the file system with
+// sftp and scp. Every transfer is passed to logTransfer if it is set.
+func (server *Server) HandleFiles(files FileSystem, logTransfer func(Transfer)) {
+	server.files = files
+	server.logTransfer = logTransfer
+}
+
+func (server *Server) transferred(transfer Transfer) {
+	if server.logTransfer != nil {
+		server.logTransfer(transfer)
+	}
+}
+
+// resolve will make the path absolute from the player's home
+func (server *Server) resolve(sess *Session, name string) string {
+	if !path.IsAbs(name) {
+		name = path.Join(server.files.Home(sess), name)
+	}
+	return path.Clean(name)
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+type testFiles struct {
+	mx        sync.Mutex
+	fsys      fstest.MapFS
+	transfers []Transfer
+}
+
+func newTestFiles() *testFiles {
+	return &testFiles{fsys: fstest.MapFS{
+		"home/readme.md": &fstest.MapFile{Data: []byte("hello"), Mode: 0644},
+		"locked":         &fstest.MapFile{Mode: fs.ModeDir | 0500},
+	}}
+}
+
+func (files *testFiles) Home(sess *Session) string { return "/home" }
+
+func (files *testFiles) Stat(sess *Session, name string) (fs.FileInfo, error) {
+	files.mx.Lock()
+	defer files.mx.Unlock()
+	return fs.Stat(files.fsys, strings.TrimPrefix(name, "/"))
+}
+
+func (files *testFiles) ReadDir(sess *Session, name string) ([]fs.FileInfo, error) {
+	files.mx.Lock()
+	defer files.mx.Unlock()
+	entries, err := fs.ReadDir(files.fsys, strings.TrimPrefix(name, "/"))
+	infos := []fs.FileInfo{}
+	for _, entry := range entries {
+		info, _ := entry.Info()
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+func (files *testFiles) ReadFile(sess *Session, name string) ([]byte, error) {
+	files.mx.Lock()
+	defer files.mx.Unlock()
+	return fs.ReadFile(files.fsys, strings.TrimPrefix(name, "/"))
+}
+
+func (files *testFiles) WriteFile(sess *Session, name string, data []byte, perm fs.FileMode) error {
+	files.mx.Lock()
+	defer files.mx.Unlock()
+	if strings.HasPrefix(name, "/locked/") {
+		return fs.ErrPermission
+	}
+	files.fsys[strings.TrimPrefix(name, "/")] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+func (files *testFiles) logTransfer(transfer Transfer) {
+	files.mx.Lock()
+	defer files.mx.Unlock()
+	transfer.Session = nil
+	files.transfers = append(files.transfers, transfer)
+}
+
+func fileServer(t *testing.T) (*testFiles, *ssh.Client) {
+	files := newTestFiles()
+	server := New()
+	server.HandleSSH("> ", "", testHandler)
+	server.HandleFiles(files, files.logTransfer)
+	return files, sshClient(t, server)
+}
+
+// sftpClient will start the sftp subsystem and reuse the server's framing to
+// talk to it
+func sftpClient(t *testing.T, client *ssh.Client) *sftpServer {
+	sess, err := client.NewSession()
+	assert.Nil(t, err)
+	stdin, err := sess.StdinPipe()
+	assert.Nil(t, err)
+	stdout, err := sess.StdoutPipe()
+	assert.Nil(t, err)
+	assert.Nil(t, sess.RequestSubsystem("sftp"))
+	return &sftpServer{rw: struct {
+		io.Reader
+		io.Writer
+	}{stdout, stdin}}
+}
+
+func sftpCall(t *testing.T, sftp *sftpServer, kind byte, payload sftpReply) (byte, *sftpPacket) {
+	assert.Nil(t, sftp.writePacket(kind, payload))
+	reply, pkt, err := sftp.readPacket()
+	assert.Nil(t, err)
+	if reply != sftpVersion {
+		assert.Equal(t, uint32(7), pkt.uint32())
+	}
+	return reply, pkt
+}
+
+func sftpOpenHandle(t *testing.T, sftp *sftpServer, kind byte, payload sftpReply) string {
+	reply, pkt := sftpCall(t, sftp, kind, payload)
+	assert.Equal(t, byte(sftpHandleID), reply)
+	return pkt.string()
+}
+
+func assertStatus(t *testing.T, code uint32, reply byte, pkt *sftpPacket) {
+	assert.Equal(t, byte(sftpStatus), reply)
+	assert.Equal(t, code, pkt.uint32())
+}
+
+func TestSFTP(t *testing.T) {
+	files, client := fileServer(t)
+	sftp := sftpClient(t, client)
+
+	reply, pkt := sftpCall(t, sftp, sftpInit, sftpReply{}.uint32(3))
+	assert.Equal(t, byte(sftpVersion), reply)
+	assert.Equal(t, uint32(3), pkt.uint32())
+
+	reply, pkt = sftpCall(t, sftp, sftpRealpath, sftpReply{}.uint32(7).string("."))
+	assert.Equal(t, byte(sftpName), reply)
+	assert.Equal(t, uint32(1), pkt.uint32())
+	assert.Equal(t, "/home", pkt.string())
+
+	handle := sftpOpenHandle(t, sftp, sftpOpen, sftpReply{}.uint32(7).string("readme.md").uint32(1).uint32(0))
+	reply, pkt = sftpCall(t, sftp, sftpRead, sftpReply{}.uint32(7).string(handle).uint32(0).uint32(0).uint32(1024))
+	assert.Equal(t, byte(sftpData), reply)
+	assert.Equal(t, "hello", pkt.string())
+	reply, pkt = sftpCall(t, sftp, sftpRead, sftpReply{}.uint32(7).string(handle).uint32(0).uint32(5).uint32(1024))
+	assertStatus(t, sftpEOF, reply, pkt)
+	reply, pkt = sftpCall(t, sftp, sftpClose, sftpReply{}.uint32(7).string(handle))
+	assertStatus(t, sftpOK, reply, pkt)
+
+	reply, pkt = sftpCall(t, sftp, sftpOpen, sftpReply{}.uint32(7).string("/missing").uint32(1).uint32(0))
+	assertStatus(t, sftpNoSuchFile, reply, pkt)
+
+	handle = sftpOpenHandle(t, sftp, sftpOpen, sftpReply{}.uint32(7).string("answer.txt").uint32(0x1a).uint32(0))
+	reply, pkt = sftpCall(t, sftp, sftpWrite, sftpReply{}.uint32(7).string(handle).uint32(0).uint32(1).string("2"))
+	assertStatus(t, sftpOK, reply, pkt)
+	reply, pkt = sftpCall(t, sftp, sftpWrite, sftpReply{}.uint32(7).string(handle).uint32(0).uint32(0).string("4"))
+	assertStatus(t, sftpOK, reply, pkt)
+	reply, pkt = sftpCall(t, sftp, sftpClose, sftpReply{}.uint32(7).string(handle))
+	assertStatus(t, sftpOK, reply, pkt)
+	assert.Equal(t, "42", string(files.fsys["home/answer.txt"].Data))
+
+	handle = sftpOpenHandle(t, sftp, sftpOpen, sftpReply{}.uint32(7).string("/locked/answer.txt").uint32(0x1a).uint32(0))
+	reply, pkt = sftpCall(t, sftp, sftpClose, sftpReply{}.uint32(7).string(handle))
+	assertStatus(t, sftpPermissionDenied, reply, pkt)
+
+	handle = sftpOpenHandle(t, sftp, sftpOpendir, sftpReply{}.uint32(7).string("/home"))
+	reply, pkt = sftpCall(t, sftp, sftpReaddir, sftpReply{}.uint32(7).string(handle))
+	assert.Equal(t, byte(sftpName), reply)
+	assert.Equal(t, uint32(2), pkt.uint32())
+	assert.Equal(t, "answer.txt", pkt.string())
+	assert.Contains(t, pkt.string(), " 2 ")
+	reply, pkt = sftpCall(t, sftp, sftpReaddir, sftpReply{}.uint32(7).string(handle))
+	assertStatus(t, sftpEOF, reply, pkt)
+
+	reply, pkt = sftpCall(t, sftp, 18, sftpReply{}.uint32(7).string("a").string("b"))
+	assertStatus(t, sftpOpUnsupported, reply, pkt)
+
+	assert.Equal(t, []Transfer{
+		{Protocol: ProtocolSFTP, Path: "/home/readme.md", Size: 5},
+		{Protocol: ProtocolSFTP, Upload: true, Path: "/home/answer.txt", Size: 2},
+		{Protocol: ProtocolSFTP, Upload: true, Path: "/locked/answer.txt", Err: fs.ErrPermission},
+	}, files.transfers)
+}
+
+func TestSFTPLimits(t *testing.T) {
+	files, client := fileServer(t)
+	sftp := sftpClient(t, client)
+	sftpCall(t, sftp, sftpInit, sftpReply{}.uint32(3))
+
+	handle := sftpOpenHandle(t, sftp, sftpOpen, sftpReply{}.uint32(7).string("big.txt").uint32(0x1a).uint32(0))
+	reply, pkt := sftpCall(t, sftp, sftpWrite, sftpReply{}.uint32(7).string(handle).uint32(0xffffffff).uint32(0xffffffff).string("ab"))
+	assertStatus(t, sftpFailure, reply, pkt)
+	reply, pkt = sftpCall(t, sftp, sftpWrite, sftpReply{}.uint32(7).string(handle).uint32(0).uint32(sftpMaxFile-1).string("ab"))
+	assertStatus(t, sftpFailure, reply, pkt)
+	reply, pkt = sftpCall(t, sftp, sftpClose, sftpReply{}.uint32(7).string(handle))
+	assertStatus(t, sftpOK, reply, pkt)
+
+	handles := []string{}
+	for i := 0; i < sftpMaxHandles; i++ {
+		handles = append(handles, sftpOpenHandle(t, sftp, sftpOpen, sftpReply{}.uint32(7).string("readme.md").uint32(1).uint32(0)))
+	}
+	reply, pkt = sftpCall(t, sftp, sftpOpen, sftpReply{}.uint32(7).string("readme.md").uint32(1).uint32(0))
+	assertStatus(t, sftpFailure, reply, pkt)
+	for _, handle := range handles {
+		reply, pkt = sftpCall(t, sftp, sftpClose, sftpReply{}.uint32(7).string(handle))
+		assertStatus(t, sftpOK, reply, pkt)
+	}
+	assert.Equal(t, "", string(files.fsys["home/big.txt"].Data))
+}
+
+func scpExec(t *testing.T, client *ssh.Client, command string) (*ssh.Session, io.WriteCloser, *bufio.Reader) {
+	sess, err := client.NewSession()
+	assert.Nil(t, err)
+	stdin, err := sess.StdinPipe()
+	assert.Nil(t, err)
+	stdout, err := sess.StdoutPipe()
+	assert.Nil(t, err)
+	assert.Nil(t, sess.Start(command))
+	return sess, stdin, bufio.NewReader(stdout)
+}
+
+func TestSCP(t *testing.T) {
+	files, client := fileServer(t)
+
+	sess, stdin, stdout := scpExec(t, client, "scp -f readme.md")
+	stdin.Write([]byte{0})
+	header, err := stdout.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "C0644 5 readme.md\n", header)
+	stdin.Write([]byte{0})
+	data := make([]byte, 6)
+	_, err = io.ReadFull(stdout, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello\x00", string(data))
+	stdin.Write([]byte{0})
+	stdin.Close()
+	assert.Nil(t, sess.Wait())
+
+	sess, stdin, stdout = scpExec(t, client, "scp -t /home")
+	ack, _ := stdout.ReadByte()
+	assert.Equal(t, byte(0), ack)
+	io.WriteString(stdin, "C0600 2 up.txt\n")
+	ack, _ = stdout.ReadByte()
+	assert.Equal(t, byte(0), ack)
+	io.WriteString(stdin, "hi\x00")
+	ack, _ = stdout.ReadByte()
+	assert.Equal(t, byte(0), ack)
+	stdin.Close()
+	assert.Nil(t, sess.Wait())
+	assert.Equal(t, "hi", string(files.fsys["home/up.txt"].Data))
+	assert.Equal(t, fs.FileMode(0600), files.fsys["home/up.txt"].Mode)
+
+	sess, stdin, stdout = scpExec(t, client, "scp -t '/locked/no.txt'")
+	stdout.ReadByte()
+	io.WriteString(stdin, "C0644 2 no.txt\n")
+	stdout.ReadByte()
+	io.WriteString(stdin, "no\x00")
+	warning, err := stdout.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "\x01scp: /locked/no.txt: permission denied\n", warning)
+	stdin.Close()
+	sess.Wait()
+
+	sess, stdin, stdout = scpExec(t, client, "scp -f /home")
+	stdin.Write([]byte{0})
+	warning, err = stdout.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "\x01scp: /home: not a regular file\n", warning)
+	stdin.Close()
+	sess.Wait()
+
+	assert.Equal(t, []Transfer{
+		{Protocol: ProtocolSCP, Path: "/home/readme.md", Size: 5},
+		{Protocol: ProtocolSCP, Upload: true, Path: "/home/up.txt", Size: 2},
+		{Protocol: ProtocolSCP, Upload: true, Path: "/locked/no.txt", Size: 2, Err: fs.ErrPermission},
+	}, files.transfers)
+}
@@ -1,28 +1,39 @@
 package server
 
 import (
-	"errors"
 	"net"
+	"sync"
 )
 
 type Listener struct {
 	accept chan net.Conn
+	done   chan struct{}
+	once   sync.Once
 	net.Listener
 }
 
 func newListener(l net.Listener) *Listener {
-	return &Listener{make(chan net.Conn), l}
+	return &Listener{accept: make(chan net.Conn), done: make(chan struct{}), Listener: l}
 }
 
 func (l *Listener) Accept() (net.Conn, error) {
-	if l.accept == nil {
-		return nil, errors.New("Listener closed")
+	select {
+	case conn := <-l.accept:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *Listener) push(conn net.Conn) {
+	select {
+	case l.accept <- conn:
+	case <-l.done:
+		conn.Close()
 	}
-	return <-l.accept, nil
 }
 
 func (l *Listener) Close() error {
-	close(l.accept)
-	l.accept = nil
+	l.once.Do(func() { close(l.done) })
 	return nil
 }
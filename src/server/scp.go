@@ -0,0 +1,237 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/tanema/pb/src/shell"
+)
+
+type (
+	// scpConn speaks the legacy scp protocol that scp -O uses. The client runs
+	// scp -t to send files to the server and scp -f to fetch them.
+	scpConn struct {
+		server    *Server
+		sess      *Session
+		r         *bufio.Reader
+		w         io.Writer
+		recursive bool
+	}
+)
+
+var errSCPUsage = errors.New("usage: scp [-r] -t|-f path ...")
+
+// isSCP will return true if the exec command is the remote end of scp
+func isSCP(command string) bool {
+	return command == "scp" || strings.HasPrefix(command, "scp ")
+}
+
+// serveSCP will run the remote end of an scp command
+func (server *Server) serveSCP(sess *Session, rw io.ReadWriter, command string) error {
+	pipeline, err := shell.Parse(command)
+	if err != nil || len(pipeline) != 1 {
+		return errSCPUsage
+	}
+	scp := &scpConn{server: server, sess: sess, r: bufio.NewReader(rw), w: rw}
+	var sink, source bool
+	paths := []string{}
+	for _, arg := range pipeline[0][1:] {
+		if arg == "-t" {
+			sink = true
+		} else if arg == "-f" {
+			source = true
+		} else if arg == "-r" {
+			scp.recursive = true
+		} else if !strings.HasPrefix(arg, "-") {
+			paths = append(paths, server.resolve(sess, arg))
+		}
+	}
+	if sink == source || len(paths) == 0 {
+		return scp.fatal(errSCPUsage)
+	} else if sink {
+		return scp.receive(paths[0])
+	}
+	if err := scp.readAck(); err != nil {
+		return err
+	}
+	for _, name := range paths {
+		if err := scp.send(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receive will save what the client sends to the target, a directory that
+// they are put into or the name of a single file.
+func (scp *scpConn) receive(target string) error {
+	dirs := []string{}
+	if info, err := scp.server.files.Stat(scp.sess, target); err == nil && info.IsDir() {
+		dirs = append(dirs, target)
+	}
+	if err := scp.ack(); err != nil {
+		return err
+	}
+	for {
+		line, err := scp.r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "C"):
+			mode, size, name, err := parseSCPHeader(line)
+			if err != nil {
+				return scp.fatal(err)
+			} else if err := scp.ack(); err != nil {
+				return err
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(scp.r, data); err != nil {
+				return err
+			} else if err := scp.readAck(); err != nil {
+				return err
+			}
+			dest := target
+			if len(dirs) > 0 {
+				dest = path.Join(dirs[len(dirs)-1], name)
+			}
+			err = scp.server.files.WriteFile(scp.sess, dest, data, mode)
+			scp.server.transferred(Transfer{Session: scp.sess, Protocol: ProtocolSCP, Upload: true, Path: dest, Size: len(data), Err: err})
+			if err != nil {
+				scp.warn(dest, err)
+			} else if err := scp.ack(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "D"):
+			_, _, name, err := parseSCPHeader(line)
+			if err != nil {
+				return scp.fatal(err)
+			} else if len(dirs) == 0 {
+				return scp.fatal(fmt.Errorf("%v: %v", target, errNotDir))
+			}
+			dir := path.Join(dirs[len(dirs)-1], name)
+			if info, err := scp.server.files.Stat(scp.sess, dir); err != nil || !info.IsDir() {
+				return scp.fatal(fmt.Errorf("%v: cannot create directories", dir))
+			}
+			dirs = append(dirs, dir)
+			if err := scp.ack(); err != nil {
+				return err
+			}
+		case line == "E":
+			if len(dirs) > 0 {
+				dirs = dirs[:len(dirs)-1]
+			}
+			if err := scp.ack(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "T"):
+			if err := scp.ack(); err != nil {
+				return err
+			}
+		default:
+			return scp.fatal(fmt.Errorf("unexpected %q", line))
+		}
+	}
+}
+
+// send will send a file, or a directory and everything in it if scp was asked
+// to be recursive. Files that cannot be read are skipped with a warning.
+func (scp *scpConn) send(name string) error {
+	info, err := scp.server.files.Stat(scp.sess, name)
+	if err != nil {
+		return scp.warn(name, err)
+	} else if info.IsDir() {
+		return scp.sendDir(name, info)
+	}
+	data, err := scp.server.files.ReadFile(scp.sess, name)
+	scp.server.transferred(Transfer{Session: scp.sess, Protocol: ProtocolSCP, Path: name, Size: len(data), Err: err})
+	if err != nil {
+		return scp.warn(name, err)
+	}
+	fmt.Fprintf(scp.w, "C%04o %d %v\n", info.Mode().Perm(), len(data), info.Name())
+	if err := scp.readAck(); err != nil {
+		return err
+	} else if _, err := scp.w.Write(append(data, 0)); err != nil {
+		return err
+	}
+	return scp.readAck()
+}
+
+func (scp *scpConn) sendDir(name string, info fs.FileInfo) error {
+	if !scp.recursive {
+		return scp.warn(name, errors.New("not a regular file"))
+	}
+	entries, err := scp.server.files.ReadDir(scp.sess, name)
+	if err != nil {
+		return scp.warn(name, err)
+	}
+	fmt.Fprintf(scp.w, "D%04o 0 %v\n", info.Mode().Perm(), info.Name())
+	if err := scp.readAck(); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := scp.send(path.Join(name, entry.Name())); err != nil {
+			return err
+		}
+	}
+	io.WriteString(scp.w, "E\n")
+	return scp.readAck()
+}
+
+func parseSCPHeader(line string) (fs.FileMode, int, string, error) {
+	parts := strings.SplitN(line[1:], " ", 3)
+	if len(parts) != 3 || strings.ContainsAny(parts[2], "/") || parts[2] == ".." {
+		return 0, 0, "", fmt.Errorf("bad header %q", line)
+	}
+	mode, err := strconv.ParseUint(parts[0], 8, 32)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("bad mode %q", parts[0])
+	}
+	size, err := strconv.Atoi(parts[1])
+	if err != nil || size < 0 || size > sftpMaxFile {
+		return 0, 0, "", fmt.Errorf("bad size %q", parts[1])
+	}
+	return fs.FileMode(mode).Perm(), size, parts[2], nil
+}
+
+func (scp *scpConn) ack() error {
+	_, err := scp.w.Write([]byte{0})
+	return err
+}
+
+// readAck will wait for the client to be ready. A warning from the client is
+// read and ignored, anything else ends the transfer.
+func (scp *scpConn) readAck() error {
+	code, err := scp.r.ReadByte()
+	if err != nil {
+		return err
+	} else if code == 0 {
+		return nil
+	}
+	msg, _ := scp.r.ReadString('\n')
+	if code == 1 {
+		return nil
+	}
+	return errors.New(strings.TrimSpace(msg))
+}
+
+// warn will tell the client that a file failed and carry on
+func (scp *scpConn) warn(name string, err error) error {
+	_, werr := fmt.Fprintf(scp.w, "\x01scp: %v: %v\n", name, err)
+	return werr
+}
+
+// fatal will tell the client that the transfer cannot continue
+func (scp *scpConn) fatal(err error) error {
+	fmt.Fprintf(scp.w, "\x02scp: %v\n", err)
+	return err
+}
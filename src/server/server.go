@@ -2,12 +2,14 @@ package server
 
 import (
 	"bufio"
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -18,41 +20,91 @@ import (
 var key []byte
 
 type Server struct {
-	mux      *http.ServeMux
-	host     string
-	listener net.Listener
-	http     net.Listener
-	closed   chan error
+	mux        *http.ServeMux
+	host       string
+	listener   net.Listener
+	http       net.Listener
+	httpServer *http.Server
+
+	mx       sync.Mutex
+	wg       sync.WaitGroup
+	done     chan struct{}
+	conns    map[net.Conn]struct{}
+	sessions map[*Session]struct{}
 
 	ssh        net.Listener
 	sshPrompt  string
 	sshBanner  string
-	sshHandler func(io.Writer, string) error
+	sshHandler SSHHandler
+	sshAuth    SSHAuth
+
+	files       FileSystem
+	logTransfer func(Transfer)
+	onClose     func(*Session)
 }
 
+const (
+	peekTimeout     = 10 * time.Second
+	shutdownTimeout = 5 * time.Second
+	goodbye         = "\nThe server is shutting down, goodbye."
+)
+
+// ErrServerClosed is returned by ListenAndServe once the server has been shut
+// down
+var ErrServerClosed = errors.New("server closed")
+
 func New() *Server {
 	return &Server{
-		mux:    http.NewServeMux(),
-		closed: make(chan error),
+		mux:      http.NewServeMux(),
+		done:     make(chan struct{}),
+		conns:    map[net.Conn]struct{}{},
+		sessions: map[*Session]struct{}{},
 	}
 }
 
-func (server *Server) ListenAndServe(host string) error {
-	var err error
-	server.listener, err = net.Listen("tcp", host)
+// ListenAndServe will serve http and ssh on the same address until the context
+// is done, and then shut down gracefully. It returns nil once the server has
+// been shut down.
+func (server *Server) ListenAndServe(ctx context.Context, host string) error {
+	listener, err := net.Listen("tcp", host)
 	if err != nil {
 		return err
 	}
-
+	server.mx.Lock()
+	if server.closing() {
+		server.mx.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	}
 	server.host = host
-	server.http = newListener(server.listener)
-	server.ssh = newListener(server.listener)
+	server.listener = listener
+	server.http = newListener(listener)
+	server.ssh = newListener(listener)
+	server.httpServer = &http.Server{Handler: server.mux}
+	server.wg.Add(3)
+	server.mx.Unlock()
 
-	go server.atc()
-	go http.Serve(server.http, server.mux)
-	go server.serveSSH()
+	go func() {
+		defer server.wg.Done()
+		server.atc()
+	}()
+	go func() {
+		defer server.wg.Done()
+		server.httpServer.Serve(server.http)
+	}()
+	go func() {
+		defer server.wg.Done()
+		server.serveSSH()
+	}()
 
-	return <-server.closed
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	case <-server.done:
+		return nil
+	}
 }
 
 func (server *Server) Handle(pattern string, handler http.Handler) {
@@ -63,86 +115,184 @@ func (server *Server) HandleFunc(pattern string, handler func(http.ResponseWrite
 	server.mux.HandleFunc(pattern, handler)
 }
 
-func (server *Server) HandleSSH(prompt, banner string, handler func(io.Writer, string) error) {
+func (server *Server) HandleSSH(prompt, banner string, handler SSHHandler) {
 	server.sshPrompt = prompt
 	server.sshBanner = banner
 	server.sshHandler = handler
 }
 
+// HandleClose will call the handler once a session has finished and nothing
+// else will be asked of it, so that anything kept for the session can be let go.
+func (server *Server) HandleClose(handler func(sess *Session)) {
+	server.onClose = handler
+}
+
+// HandleSSHAuth will require players to authenticate over ssh with the methods
+// that are set, instead of letting anyone in.
+func (server *Server) HandleSSHAuth(auth SSHAuth) {
+	server.sshAuth = auth
+}
+
+// Addr will return the address the server is listening on, or nil if it is not
+// listening yet
+func (server *Server) Addr() net.Addr {
+	server.mx.Lock()
+	defer server.mx.Unlock()
+	if server.listener == nil {
+		return nil
+	}
+	return server.listener.Addr()
+}
+
+// atc will accept connections until the listener is closed and send each one on
+// to http or ssh depending on how it starts
 func (server *Server) atc() {
 	for {
 		conn, err := server.listener.Accept()
-		if err != nil {
+		if errors.Is(err, net.ErrClosed) || server.closing() {
+			return
+		} else if err != nil {
 			log.Println("Error accepting conn:", err)
+			time.Sleep(10 * time.Millisecond)
 			continue
-		}
-		conn.SetReadDeadline(time.Now().Add(time.Second * 10))
-		bconn := bufferedConn{conn, bufio.NewReaderSize(conn, 3)}
-		p, err := bconn.Peek(3)
-		conn.SetReadDeadline(time.Time{})
-		if err != nil {
-			log.Println("Error peeking into conn:", err)
-			continue
-		}
-		prefix := string(p)
-		selectedListener := server.http.(*Listener)
-		if prefix == "SSH" {
-			selectedListener = server.ssh.(*Listener)
-		}
-		if selectedListener.accept != nil {
-			selectedListener.accept <- bconn
+		} else if server.track(conn) {
+			go server.route(conn)
 		}
 	}
 }
 
-func (server *Server) serveSSH() {
-	config := &ssh.ServerConfig{
-		NoClientAuth: true,
+// route will peek at the start of the connection without holding up any others
+func (server *Server) route(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(peekTimeout))
+	bconn := bufferedConn{conn, bufio.NewReaderSize(conn, 3)}
+	p, err := bconn.Peek(3)
+	conn.SetReadDeadline(time.Time{})
+	server.release(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	selectedListener := server.http.(*Listener)
+	if string(p) == "SSH" {
+		selectedListener = server.ssh.(*Listener)
 	}
-	pk, _ := ssh.ParsePrivateKey(key)
-	config.AddHostKey(pk)
+	selectedListener.push(bconn)
+}
 
+func (server *Server) serveSSH() {
+	config := server.sshConfig()
 	for {
 		nConn, err := server.ssh.Accept()
 		if err != nil {
-			fmt.Println("accept error", err)
-			continue
+			return
+		} else if server.track(nConn) {
+			go server.serveSSHConn(nConn, config)
 		}
-		conn, chans, reqs, err := ssh.NewServerConn(nConn, config)
-		if err != nil {
-			fmt.Println("new conn error", err)
-			continue
-		}
-		go ssh.DiscardRequests(reqs)
-		go server.handleSSHConn(conn, chans)
 	}
-
 }
 
-func (server *Server) handleSSHConn(conn *ssh.ServerConn, chans <-chan ssh.NewChannel) {
-	defer conn.Close()
+func (server *Server) serveSSHConn(nConn net.Conn, config *ssh.ServerConfig) {
+	defer server.release(nConn)
+	defer nConn.Close()
+	conn, chans, reqs, err := ssh.NewServerConn(nConn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
 	for newChan := range chans {
 		if newChan.ChannelType() != "session" {
 			newChan.Reject(ssh.UnknownChannelType, "unknown channel type")
 			continue
 		}
-		ch, _, err := newChan.Accept()
+		ch, reqs, err := newChan.Accept()
 		if err != nil {
 			continue
 		}
-		defer ch.Close()
-
-		sshTerm := terminal.NewTerminal(ch, server.prompt())
-		fmt.Fprint(sshTerm, server.sshBanner)
-		for {
-			sshTerm.SetPrompt(server.prompt())
-			line, err := sshTerm.ReadLine()
-			if err != nil {
-				continue
-			}
-			if err := server.sshHandler(sshTerm, line); err != nil {
+		sess := newSession(conn, ch)
+		if !server.trackSession(sess) {
+			ch.Close()
+			continue
+		}
+		go server.handleSession(sess, reqs)
+	}
+}
+
+// handleSession will answer the requests on a session channel until the shell,
+// command or subsystem that the client asked for has finished. A command exits
+// with 1 if it returned an error.
+func (server *Server) handleSession(sess *Session, reqs <-chan *ssh.Request) {
+	defer server.releaseSession(sess)
+	defer sess.ch.Close()
+	var done chan struct{}
+	for {
+		select {
+		case req, ok := <-reqs:
+			if !ok {
+				if done != nil {
+					<-done
+				}
 				return
+			} else if server.starts(req) && done == nil {
+				done = make(chan struct{})
+				cmd := execRequest{}
+				ssh.Unmarshal(req.Payload, &cmd)
+				sess.Command = cmd.Command
+				req.Reply(true, nil)
+				go func(kind string) {
+					defer close(done)
+					var status uint32
+					if err := server.run(sess, sess.ch, kind); err != nil {
+						status = 1
+					}
+					sess.exit(status, "")
+				}(req.Type)
+			} else {
+				req.Reply(sess.handleRequest(req), nil)
 			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// starts will return true if the request is for something the server can run,
+// the sftp subsystem is only there if there are files to serve
+func (server *Server) starts(req *ssh.Request) bool {
+	if req.Type == "subsystem" {
+		subsystem := execRequest{}
+		return server.files != nil && ssh.Unmarshal(req.Payload, &subsystem) == nil && subsystem.Command == "sftp"
+	}
+	return req.Type == "shell" || req.Type == "exec"
+}
+
+func (server *Server) run(sess *Session, ch ssh.Channel, kind string) error {
+	if kind == "shell" {
+		server.shell(sess, ch)
+		return nil
+	} else if kind == "subsystem" {
+		return server.serveSFTP(sess, ch)
+	} else if server.files != nil && isSCP(sess.Command) {
+		return server.serveSCP(sess, ch, sess.Command)
+	}
+	return server.sshHandler(sess, ch, sess.Command)
+}
+
+func (server *Server) shell(sess *Session, ch ssh.Channel) {
+	sshTerm := terminal.NewTerminal(ch, server.prompt())
+	sess.mx.Lock()
+	sess.terminal = sshTerm
+	if sess.width > 0 && sess.height > 0 {
+		sshTerm.SetSize(sess.width, sess.height)
+	}
+	sess.mx.Unlock()
+	fmt.Fprint(sshTerm, server.sshBanner)
+	for {
+		sshTerm.SetPrompt(server.prompt())
+		line, err := sshTerm.ReadLine()
+		if err != nil {
+			return
+		} else if err := server.sshHandler(sess, sshTerm, line); err != nil {
+			return
 		}
 	}
 }
@@ -154,14 +304,132 @@ func (server *Server) prompt() string {
 	return server.sshPrompt
 }
 
-func (server *Server) Close() error {
-	if err := server.ssh.Close(); err != nil {
-		return err
-	} else if err := server.http.Close(); err != nil {
-		return err
-	} else if err := server.listener.Close(); err != nil {
+// Shutdown will stop accepting connections, wait for http requests to finish
+// and say goodbye to every ssh session before hanging up. If the context is
+// done first, everything still open is closed and the context's error is
+// returned.
+func (server *Server) Shutdown(ctx context.Context) error {
+	httpServer := server.stop()
+	var err error
+	if httpServer != nil {
+		err = httpServer.Shutdown(ctx)
+	}
+	waited := make(chan struct{})
+	go func() {
+		server.hangup()
+		server.wg.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
 		return err
+	case <-ctx.Done():
+		if httpServer != nil {
+			httpServer.Close()
+		}
+		server.closeConns()
+		return ctx.Err()
 	}
-	close(server.closed)
+}
+
+// Close will stop the server right away, without waiting for anything to
+// finish. It is safe to call more than once, and before the server has started.
+func (server *Server) Close() error {
+	if httpServer := server.stop(); httpServer != nil {
+		httpServer.Close()
+	}
+	server.closeConns()
 	return nil
 }
+
+// stop will mark the server as shutting down and stop accepting connections,
+// returning the http server if it was started
+func (server *Server) stop() *http.Server {
+	server.mx.Lock()
+	defer server.mx.Unlock()
+	if !server.closing() {
+		close(server.done)
+	}
+	if server.listener == nil {
+		return nil
+	}
+	server.listener.Close()
+	server.ssh.Close()
+	server.http.Close()
+	return server.httpServer
+}
+
+// hangup will say goodbye to every ssh session that is still open and then
+// close their connections
+func (server *Server) hangup() {
+	server.mx.Lock()
+	sessions := make([]*Session, 0, len(server.sessions))
+	for sess := range server.sessions {
+		sessions = append(sessions, sess)
+	}
+	server.mx.Unlock()
+	for _, sess := range sessions {
+		sess.exit(0, goodbye)
+	}
+	server.closeConns()
+}
+
+func (server *Server) closeConns() {
+	server.mx.Lock()
+	defer server.mx.Unlock()
+	for conn := range server.conns {
+		conn.Close()
+	}
+}
+
+func (server *Server) closing() bool {
+	select {
+	case <-server.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// track will hold on to a connection until it is released so that it can be
+// closed on shutdown. It returns false, and closes the connection, if the server
+// is already shutting down.
+func (server *Server) track(conn net.Conn) bool {
+	server.mx.Lock()
+	defer server.mx.Unlock()
+	if server.closing() {
+		conn.Close()
+		return false
+	}
+	server.conns[conn] = struct{}{}
+	server.wg.Add(1)
+	return true
+}
+
+func (server *Server) release(conn net.Conn) {
+	server.mx.Lock()
+	delete(server.conns, conn)
+	server.mx.Unlock()
+	server.wg.Done()
+}
+
+func (server *Server) trackSession(sess *Session) bool {
+	server.mx.Lock()
+	defer server.mx.Unlock()
+	if server.closing() {
+		return false
+	}
+	server.sessions[sess] = struct{}{}
+	server.wg.Add(1)
+	return true
+}
+
+func (server *Server) releaseSession(sess *Session) {
+	server.mx.Lock()
+	delete(server.sessions, sess)
+	server.mx.Unlock()
+	if server.onClose != nil {
+		server.onClose(sess)
+	}
+	server.wg.Done()
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func sshClient(t *testing.T, server *Server, auth ...ssh.AuthMethod) *ssh.Client {
+	client, err := dialSSH(t, server, auth...)
+	assert.Nil(t, err)
+	return client
+}
+
+func dialSSH(t *testing.T, server *Server, auth ...ssh.AuthMethod) (*ssh.Client, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		if conn, err := listener.Accept(); err == nil && server.track(conn) {
+			server.serveSSHConn(conn, server.sshConfig())
+		}
+	}()
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	conn, chans, reqs, err := ssh.NewClientConn(clientConn, listener.Addr().String(), &ssh.ClientConfig{
+		User:            "player",
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	client := ssh.NewClient(conn, chans, reqs)
+	t.Cleanup(func() { client.Close() })
+	return client, nil
+}
+
+func testHandler(sess *Session, w io.Writer, line string) error {
+	width, height := sess.Size()
+	switch line {
+	case "whoami":
+		fmt.Fprintln(w, sess.User)
+	case "auth":
+		fmt.Fprintln(w, sess.AuthMethod, sess.Fingerprint)
+	case "env":
+		fmt.Fprintln(w, sess.Getenv("LANG"))
+	case "size":
+		fmt.Fprintf(w, "%v %vx%v\n", sess.Term(), width, height)
+	case "exit":
+		return errors.New("goodbye")
+	}
+	return nil
+}
+
+func TestSSHExec(t *testing.T) {
+	server := New()
+	server.HandleSSH("> ", "", testHandler)
+	client := sshClient(t, server)
+
+	sess, err := client.NewSession()
+	assert.Nil(t, err)
+	out, err := sess.Output("whoami")
+	assert.Nil(t, err)
+	assert.Equal(t, "player\n", string(out))
+
+	sess, err = client.NewSession()
+	assert.Nil(t, err)
+	assert.Nil(t, sess.Setenv("LANG", "en_CA"))
+	out, err = sess.Output("env")
+	assert.Nil(t, err)
+	assert.Equal(t, "en_CA\n", string(out))
+
+	sess, err = client.NewSession()
+	assert.Nil(t, err)
+	err = sess.Run("exit")
+	exitErr := &ssh.ExitError{}
+	assert.True(t, errors.As(err, &exitErr))
+	assert.Equal(t, 1, exitErr.ExitStatus())
+}
+
+func TestSSHShell(t *testing.T) {
+	server := New()
+	server.HandleSSH("> ", "welcome\n", testHandler)
+	client := sshClient(t, server)
+
+	sess, err := client.NewSession()
+	assert.Nil(t, err)
+	stdin, err := sess.StdinPipe()
+	assert.Nil(t, err)
+	var out strings.Builder
+	sess.Stdout = &out
+	assert.Nil(t, sess.RequestPty("xterm", 24, 100, ssh.TerminalModes{}))
+	assert.Nil(t, sess.Shell())
+	assert.Nil(t, sess.WindowChange(30, 120))
+	time.Sleep(50 * time.Millisecond)
+	io.WriteString(stdin, "size\rexit\r")
+	assert.Nil(t, sess.Wait())
+	assert.Contains(t, out.String(), "welcome")
+	assert.Contains(t, out.String(), "xterm 120x30")
+}
+
+func authOutput(t *testing.T, client *ssh.Client) string {
+	sess, err := client.NewSession()
+	assert.Nil(t, err)
+	out, err := sess.Output("auth")
+	assert.Nil(t, err)
+	return strings.TrimSpace(string(out))
+}
+
+func TestSSHAuth(t *testing.T) {
+	server := New()
+	server.HandleSSH("> ", "", testHandler)
+	assert.Equal(t, AuthNone, authOutput(t, sshClient(t, server)))
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(private)
+	assert.Nil(t, err)
+	authorized, err := ParseAuthorizedKeys(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	assert.Nil(t, err)
+
+	server.HandleSSHAuth(SSHAuth{
+		Password:       func(user, password string) bool { return password == "hackerman" },
+		AuthorizedKeys: authorized,
+		KeyboardInteractive: func(user string, challenge ssh.KeyboardInteractiveChallenge) bool {
+			first, err := challenge("", "", []string{"favourite colour? "}, []bool{true})
+			if err != nil || first[0] != "blue" {
+				return false
+			}
+			second, err := challenge("", "", []string{"airspeed of a swallow? "}, []bool{true})
+			return err == nil && second[0] == "african or european?"
+		},
+	})
+
+	_, err = dialSSH(t, server)
+	assert.NotNil(t, err)
+	_, err = dialSSH(t, server, ssh.Password("wrong"))
+	assert.NotNil(t, err)
+	assert.Equal(t, AuthPassword, authOutput(t, sshClient(t, server, ssh.Password("hackerman"))))
+	assert.Equal(t, AuthPublicKey+" "+ssh.FingerprintSHA256(signer.PublicKey()), authOutput(t, sshClient(t, server, ssh.PublicKeys(signer))))
+
+	answers := []string{"blue", "african or european?"}
+	client := sshClient(t, server, ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answer := answers[:len(questions)]
+		answers = answers[len(questions):]
+		return answer, nil
+	}))
+	assert.Equal(t, AuthKeyboardInteractive, authOutput(t, client))
+}
+
+// listen will start the server on a free port and return its address and the
+// result of ListenAndServe
+func listen(t *testing.T, ctx context.Context, server *Server) (string, chan error) {
+	served := make(chan error, 1)
+	go func() { served <- server.ListenAndServe(ctx, "127.0.0.1:0") }()
+	for i := 0; i < 100 && server.Addr() == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NotNil(t, server.Addr())
+	return server.Addr().String(), served
+}
+
+func TestListenAndServeShutdown(t *testing.T) {
+	server := New()
+	server.HandleSSH("> ", "welcome\n", testHandler)
+	server.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("hello")) })
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, served := listen(t, ctx, server)
+
+	resp, err := http.Get("http://" + addr)
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "hello", string(body))
+
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{User: "player", HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	assert.Nil(t, err)
+	defer client.Close()
+	sess, err := client.NewSession()
+	assert.Nil(t, err)
+	stdin, _ := sess.StdinPipe()
+	defer stdin.Close()
+	stdout, _ := sess.StdoutPipe()
+	assert.Nil(t, sess.Shell())
+	banner := make([]byte, len("welcome\n> "))
+	_, err = io.ReadFull(stdout, banner)
+	assert.Nil(t, err)
+
+	cancel()
+	assert.Nil(t, <-served)
+	rest, _ := io.ReadAll(stdout)
+	assert.Contains(t, string(rest), "The server is shutting down, goodbye.")
+	assert.Nil(t, sess.Wait())
+
+	_, err = net.Dial("tcp", addr)
+	assert.NotNil(t, err)
+	assert.Nil(t, server.Shutdown(context.Background()))
+	assert.Nil(t, server.Close())
+}
+
+func TestShutdownDrainsHTTP(t *testing.T) {
+	server := New()
+	started, release := make(chan struct{}), make(chan struct{})
+	server.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("finished"))
+	})
+	addr, served := listen(t, context.Background(), server)
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		assert.Nil(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		responses <- string(body)
+	}()
+	<-started
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- server.Shutdown(context.Background()) }()
+	assert.Nil(t, <-served)
+	select {
+	case <-shutdown:
+		t.Fatal("shutdown did not wait for the request")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.Nil(t, <-shutdown)
+	assert.Equal(t, "finished", <-responses)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	server := New()
+	stuck := make(chan struct{})
+	defer close(stuck)
+	server.HandleSSH("> ", "", func(sess *Session, w io.Writer, line string) error {
+		<-stuck
+		return nil
+	})
+	addr, served := listen(t, context.Background(), server)
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{User: "player", HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	assert.Nil(t, err)
+	defer client.Close()
+	sess, err := client.NewSession()
+	assert.Nil(t, err)
+	assert.Nil(t, sess.Start("stuck"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, server.Shutdown(ctx))
+	assert.Nil(t, <-served)
+}
+
+func TestCloseBeforeListen(t *testing.T) {
+	server := New()
+	assert.Nil(t, server.Close())
+	assert.Nil(t, server.Close())
+	assert.Nil(t, server.Shutdown(context.Background()))
+	assert.Equal(t, ErrServerClosed, server.ListenAndServe(context.Background(), "127.0.0.1:0"))
+}
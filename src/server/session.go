@@ -0,0 +1,143 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+type (
+	// SSHHandler is called with each line the player enters in a shell, or once
+	// with the command of an exec request. Returning an error ends the session.
+	SSHHandler func(sess *Session, w io.Writer, line string) error
+	// Session is a single ssh session and what the client has told the server
+	// about itself. AuthMethod is how the player authenticated and Fingerprint
+	// is the fingerprint of their key if they used one.
+	Session struct {
+		User        string
+		RemoteAddr  net.Addr
+		Command     string
+		AuthMethod  string
+		Fingerprint string
+		mx          sync.Mutex
+		env         map[string]string
+		term        string
+		width       int
+		height      int
+		terminal    *terminal.Terminal
+		ch          ssh.Channel
+		exited      sync.Once
+	}
+	ptyRequest struct {
+		Term          string
+		Columns, Rows uint32
+		Width, Height uint32
+		Modes         string
+	}
+	windowChange struct {
+		Columns, Rows uint32
+		Width, Height uint32
+	}
+	envRequest struct {
+		Name, Value string
+	}
+	execRequest struct {
+		Command string
+	}
+	exitStatus struct {
+		Status uint32
+	}
+)
+
+func newSession(conn *ssh.ServerConn, ch ssh.Channel) *Session {
+	sess := &Session{User: conn.User(), RemoteAddr: conn.RemoteAddr(), AuthMethod: AuthNone, env: map[string]string{}, ch: ch}
+	if conn.Permissions != nil && conn.Permissions.Extensions[authMethodExt] != "" {
+		sess.AuthMethod = conn.Permissions.Extensions[authMethodExt]
+		sess.Fingerprint = conn.Permissions.Extensions[fingerprintExt]
+	}
+	return sess
+}
+
+// Getenv will return an environment variable the client sent
+func (sess *Session) Getenv(name string) string {
+	sess.mx.Lock()
+	defer sess.mx.Unlock()
+	return sess.env[name]
+}
+
+// Term will return the terminal type the client asked for, it is empty if the
+// client did not ask for a pty
+func (sess *Session) Term() string {
+	sess.mx.Lock()
+	defer sess.mx.Unlock()
+	return sess.term
+}
+
+// Size will return the width and height of the client's terminal
+func (sess *Session) Size() (int, int) {
+	sess.mx.Lock()
+	defer sess.mx.Unlock()
+	return sess.width, sess.height
+}
+
+func (sess *Session) resize(width, height uint32) {
+	sess.mx.Lock()
+	defer sess.mx.Unlock()
+	sess.width, sess.height = int(width), int(height)
+	if sess.terminal != nil && width > 0 && height > 0 {
+		sess.terminal.SetSize(sess.width, sess.height)
+	}
+}
+
+// exit will send the exit status and close the channel, saying farewell first
+// if the player is in a shell. Only the first exit counts if the session is
+// ended more than once.
+func (sess *Session) exit(status uint32, farewell string) {
+	sess.exited.Do(func() {
+		sess.mx.Lock()
+		sshTerm := sess.terminal
+		sess.mx.Unlock()
+		if sshTerm != nil && farewell != "" {
+			fmt.Fprintln(sshTerm, farewell)
+		}
+		sess.ch.SendRequest("exit-status", false, ssh.Marshal(&exitStatus{Status: status}))
+		sess.ch.Close()
+	})
+}
+
+// handleRequest will apply a request on the session channel and return true if
+// it was understood
+func (sess *Session) handleRequest(req *ssh.Request) bool {
+	switch req.Type {
+	case "pty-req":
+		pty := ptyRequest{}
+		if ssh.Unmarshal(req.Payload, &pty) != nil {
+			return false
+		}
+		sess.mx.Lock()
+		sess.term = pty.Term
+		sess.mx.Unlock()
+		sess.resize(pty.Columns, pty.Rows)
+	case "window-change":
+		change := windowChange{}
+		if ssh.Unmarshal(req.Payload, &change) != nil {
+			return false
+		}
+		sess.resize(change.Columns, change.Rows)
+	case "env":
+		env := envRequest{}
+		if ssh.Unmarshal(req.Payload, &env) != nil {
+			return false
+		}
+		sess.mx.Lock()
+		sess.env[env.Name] = env.Value
+		sess.mx.Unlock()
+	default:
+		return false
+	}
+	return true
+}
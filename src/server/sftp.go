@@ -0,0 +1,337 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+)
+
+type (
+	// sftpServer speaks version 3 of the sftp protocol, which is what OpenSSH
+	// uses, over a session channel. Files are read whole when opened and
+	// written whole when closed.
+	sftpServer struct {
+		server  *Server
+		sess    *Session
+		rw      io.ReadWriter
+		handles map[string]*sftpHandle
+		next    int
+	}
+	sftpHandle struct {
+		path    string
+		data    []byte
+		upload  bool
+		dir     bool
+		entries []fs.FileInfo
+	}
+	// sftpPacket reads the fields of a request out of its payload
+	sftpPacket struct {
+		data []byte
+		err  error
+	}
+	// sftpReply builds up the payload of a response
+	sftpReply []byte
+)
+
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpWrite    = 6
+	sftpLstat    = 7
+	sftpFstat    = 8
+	sftpSetstat  = 9
+	sftpFsetstat = 10
+	sftpOpendir  = 11
+	sftpReaddir  = 12
+	sftpRealpath = 16
+	sftpStat     = 17
+	sftpStatus   = 101
+	sftpHandleID = 102
+	sftpData     = 103
+	sftpName     = 104
+	sftpAttrs    = 105
+
+	sftpOK               = 0
+	sftpEOF              = 1
+	sftpNoSuchFile       = 2
+	sftpPermissionDenied = 3
+	sftpFailure          = 4
+	sftpBadMessage       = 5
+	sftpOpUnsupported    = 8
+
+	sftpFlagWrite = 0x02
+	sftpFlagTrunc = 0x10
+
+	sftpAttrSize        = 0x01
+	sftpAttrPermissions = 0x04
+	sftpAttrTimes       = 0x08
+
+	sftpMaxPacket  = 256 * 1024
+	sftpMaxFile    = 16 * 1024 * 1024
+	sftpMaxHandles = 16
+	modeDir        = 0040000
+	modeRegular    = 0100000
+)
+
+var (
+	errBadPacket      = errors.New("bad sftp packet")
+	errTooManyHandles = errors.New("too many open files")
+)
+
+// serveSFTP will answer sftp requests on the channel until the client hangs up
+func (server *Server) serveSFTP(sess *Session, rw io.ReadWriter) error {
+	sftp := &sftpServer{server: server, sess: sess, rw: rw, handles: map[string]*sftpHandle{}}
+	for {
+		kind, pkt, err := sftp.readPacket()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		} else if kind == sftpInit {
+			err = sftp.writePacket(sftpVersion, sftpReply{}.uint32(3))
+		} else if id := pkt.uint32(); pkt.err != nil {
+			return pkt.err
+		} else {
+			err = sftp.handle(kind, id, pkt)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (sftp *sftpServer) readPacket() (byte, *sftpPacket, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(sftp.rw, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > sftpMaxPacket {
+		return 0, nil, errBadPacket
+	}
+	data := make([]byte, length-1)
+	if _, err := io.ReadFull(sftp.rw, data); err != nil {
+		return 0, nil, err
+	}
+	return header[4], &sftpPacket{data: data}, nil
+}
+
+func (sftp *sftpServer) writePacket(kind byte, payload sftpReply) error {
+	packet := sftpReply{}.uint32(uint32(len(payload) + 1))
+	packet = append(append(packet, kind), payload...)
+	_, err := sftp.rw.Write(packet)
+	return err
+}
+
+func (sftp *sftpServer) handle(kind byte, id uint32, pkt *sftpPacket) error {
+	switch kind {
+	case sftpOpen:
+		name, flags := sftp.server.resolve(sftp.sess, pkt.string()), pkt.uint32()
+		if pkt.err != nil {
+			return sftp.status(id, pkt.err)
+		}
+		return sftp.open(id, name, flags&sftpFlagWrite != 0, flags&sftpFlagTrunc != 0)
+	case sftpOpendir:
+		name := sftp.server.resolve(sftp.sess, pkt.string())
+		entries, err := sftp.server.files.ReadDir(sftp.sess, name)
+		if err != nil {
+			return sftp.status(id, err)
+		}
+		return sftp.newHandle(id, &sftpHandle{path: name, dir: true, entries: entries})
+	case sftpRead:
+		handle, offset, length := sftp.handles[pkt.string()], pkt.uint64(), pkt.uint32()
+		if handle == nil || handle.dir {
+			return sftp.status(id, fs.ErrInvalid)
+		} else if offset >= uint64(len(handle.data)) {
+			return sftp.writeStatus(id, sftpEOF, "EOF")
+		}
+		end := offset + uint64(length)
+		if end > uint64(len(handle.data)) {
+			end = uint64(len(handle.data))
+		}
+		return sftp.writePacket(sftpData, sftpReply{}.uint32(id).bytes(handle.data[offset:end]))
+	case sftpWrite:
+		handle, offset, data := sftp.handles[pkt.string()], pkt.uint64(), pkt.bytes()
+		if handle == nil || !handle.upload || pkt.err != nil {
+			return sftp.status(id, fs.ErrInvalid)
+		} else if offset > sftpMaxFile || uint64(len(data)) > sftpMaxFile-offset {
+			return sftp.status(id, fs.ErrInvalid)
+		}
+		if end := int(offset) + len(data); end > len(handle.data) {
+			handle.data = append(handle.data, make([]byte, end-len(handle.data))...)
+		}
+		copy(handle.data[offset:], data)
+		return sftp.status(id, nil)
+	case sftpReaddir:
+		handle := sftp.handles[pkt.string()]
+		if handle == nil || !handle.dir {
+			return sftp.status(id, fs.ErrInvalid)
+		} else if len(handle.entries) == 0 {
+			return sftp.writeStatus(id, sftpEOF, "EOF")
+		}
+		reply := sftpReply{}.uint32(id).uint32(uint32(len(handle.entries)))
+		for _, info := range handle.entries {
+			reply = reply.string(info.Name()).string(longName(info)).attrs(info)
+		}
+		handle.entries = nil
+		return sftp.writePacket(sftpName, reply)
+	case sftpClose:
+		key := pkt.string()
+		handle := sftp.handles[key]
+		if handle == nil {
+			return sftp.status(id, fs.ErrInvalid)
+		}
+		delete(sftp.handles, key)
+		return sftp.status(id, sftp.close(handle))
+	case sftpStat, sftpLstat:
+		info, err := sftp.server.files.Stat(sftp.sess, sftp.server.resolve(sftp.sess, pkt.string()))
+		if err != nil {
+			return sftp.status(id, err)
+		}
+		return sftp.writePacket(sftpAttrs, sftpReply{}.uint32(id).attrs(info))
+	case sftpFstat:
+		handle := sftp.handles[pkt.string()]
+		if handle == nil {
+			return sftp.status(id, fs.ErrInvalid)
+		}
+		info, err := sftp.server.files.Stat(sftp.sess, handle.path)
+		if err != nil {
+			return sftp.status(id, err)
+		}
+		return sftp.writePacket(sftpAttrs, sftpReply{}.uint32(id).attrs(info))
+	case sftpRealpath:
+		name := sftp.server.resolve(sftp.sess, pkt.string())
+		reply := sftpReply{}.uint32(id).uint32(1).string(name).string(name).uint32(0)
+		return sftp.writePacket(sftpName, reply)
+	case sftpSetstat, sftpFsetstat:
+		return sftp.status(id, nil)
+	}
+	return sftp.writeStatus(id, sftpOpUnsupported, "operation unsupported")
+}
+
+// open will read the whole file for a download, or start with an empty file, or
+// the file that is there if it is not truncated, for an upload
+func (sftp *sftpServer) open(id uint32, name string, upload, truncate bool) error {
+	handle := &sftpHandle{path: name, upload: upload}
+	if !upload || !truncate {
+		data, err := sftp.server.files.ReadFile(sftp.sess, name)
+		if err != nil && (!upload || !errors.Is(err, fs.ErrNotExist)) {
+			return sftp.status(id, err)
+		}
+		handle.data = data
+	}
+	return sftp.newHandle(id, handle)
+}
+
+// close will write an upload and log the transfer of a file
+func (sftp *sftpServer) close(handle *sftpHandle) error {
+	if handle.dir {
+		return nil
+	}
+	var err error
+	if handle.upload {
+		err = sftp.server.files.WriteFile(sftp.sess, handle.path, handle.data, 0644)
+	}
+	sftp.server.transferred(Transfer{
+		Session:  sftp.sess,
+		Protocol: ProtocolSFTP,
+		Upload:   handle.upload,
+		Path:     handle.path,
+		Size:     len(handle.data),
+		Err:      err,
+	})
+	return err
+}
+
+// newHandle will keep the handle open until it is closed, each one can hold a
+// whole file so only a few can be open at once
+func (sftp *sftpServer) newHandle(id uint32, handle *sftpHandle) error {
+	if len(sftp.handles) >= sftpMaxHandles {
+		return sftp.status(id, errTooManyHandles)
+	}
+	sftp.next++
+	key := strconv.Itoa(sftp.next)
+	sftp.handles[key] = handle
+	return sftp.writePacket(sftpHandleID, sftpReply{}.uint32(id).string(key))
+}
+
+func (sftp *sftpServer) status(id uint32, err error) error {
+	if err == nil {
+		return sftp.writeStatus(id, sftpOK, "OK")
+	} else if errors.Is(err, fs.ErrNotExist) {
+		return sftp.writeStatus(id, sftpNoSuchFile, err.Error())
+	} else if errors.Is(err, fs.ErrPermission) {
+		return sftp.writeStatus(id, sftpPermissionDenied, err.Error())
+	} else if errors.Is(err, errBadPacket) {
+		return sftp.writeStatus(id, sftpBadMessage, err.Error())
+	}
+	return sftp.writeStatus(id, sftpFailure, err.Error())
+}
+
+func (sftp *sftpServer) writeStatus(id, code uint32, msg string) error {
+	return sftp.writePacket(sftpStatus, sftpReply{}.uint32(id).uint32(code).string(msg).string(""))
+}
+
+// longName is how ls -l would show the file, which clients print as is
+func longName(info fs.FileInfo) string {
+	return fmt.Sprintf("%v    1 pb       pb       %8d %v %v",
+		info.Mode(), info.Size(), info.ModTime().Format("Jan _2 15:04"), info.Name())
+}
+
+func (pkt *sftpPacket) uint32() uint32 {
+	if pkt.err != nil || len(pkt.data) < 4 {
+		pkt.err = errBadPacket
+		return 0
+	}
+	n := binary.BigEndian.Uint32(pkt.data)
+	pkt.data = pkt.data[4:]
+	return n
+}
+
+func (pkt *sftpPacket) uint64() uint64 {
+	return uint64(pkt.uint32())<<32 | uint64(pkt.uint32())
+}
+
+func (pkt *sftpPacket) bytes() []byte {
+	n := pkt.uint32()
+	if pkt.err != nil || uint32(len(pkt.data)) < n {
+		pkt.err = errBadPacket
+		return nil
+	}
+	data := pkt.data[:n]
+	pkt.data = pkt.data[n:]
+	return data
+}
+
+func (pkt *sftpPacket) string() string {
+	return string(pkt.bytes())
+}
+
+func (reply sftpReply) uint32(n uint32) sftpReply {
+	return binary.BigEndian.AppendUint32(reply, n)
+}
+
+func (reply sftpReply) bytes(data []byte) sftpReply {
+	return append(reply.uint32(uint32(len(data))), data...)
+}
+
+func (reply sftpReply) string(str string) sftpReply {
+	return reply.bytes([]byte(str))
+}
+
+func (reply sftpReply) attrs(info fs.FileInfo) sftpReply {
+	mode := uint32(info.Mode().Perm()) | modeRegular
+	if info.IsDir() {
+		mode = uint32(info.Mode().Perm()) | modeDir
+	}
+	mtime := uint32(info.ModTime().Unix())
+	reply = reply.uint32(sftpAttrSize | sftpAttrPermissions | sftpAttrTimes)
+	reply = binary.BigEndian.AppendUint64(reply, uint64(info.Size()))
+	return reply.uint32(mode).uint32(mtime).uint32(mtime)
+}
@@ -0,0 +1,78 @@
+package shell
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	errUnterminated = errors.New("unexpected end of line, a quote was not closed")
+	errEmptyPipe    = errors.New("syntax error near unexpected token `|'")
+)
+
+// Parse will split a line into the commands of a pipeline and each command into
+// its arguments. Single quotes keep everything inside them as is, double quotes
+// allow \" and \\ to be escaped and outside of quotes a backslash escapes the
+// next character.
+func Parse(line string) ([][]string, error) {
+	return parse(line, "")
+}
+
+// parse will split the line like Parse and replace a ~ that starts an unquoted
+// word with the home directory, if there is one
+func parse(line, home string) ([][]string, error) {
+	pipeline, args := [][]string{}, []string{}
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			args = append(args, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == ' ' || r == '\t' || r == '\n':
+			endWord()
+		case r == '|':
+			endWord()
+			if len(args) == 0 {
+				return nil, errEmptyPipe
+			}
+			pipeline, args = append(pipeline, args), []string{}
+		case r == '\\':
+			if i++; i == len(runes) {
+				return nil, errUnterminated
+			}
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == '\'' || r == '"':
+			end := i + 1
+			for ; end < len(runes) && runes[end] != r; end++ {
+				if r == '"' && runes[end] == '\\' && end+1 < len(runes) && (runes[end+1] == '"' || runes[end+1] == '\\') {
+					end++
+				}
+				word.WriteRune(runes[end])
+			}
+			if end == len(runes) {
+				return nil, errUnterminated
+			}
+			i, inWord = end, true
+		case r == '~' && !inWord && home != "" && (i+1 == len(runes) || strings.ContainsRune("/ \t\n|", runes[i+1])):
+			word.WriteString(home)
+			inWord = true
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	endWord()
+	if len(args) > 0 {
+		pipeline = append(pipeline, args)
+	} else if len(pipeline) > 0 {
+		return nil, errEmptyPipe
+	}
+	return pipeline, nil
+}
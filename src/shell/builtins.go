@@ -0,0 +1,246 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var builtins = map[string]Command{
+	"cat":    cat,
+	"cd":     cd,
+	"echo":   echo,
+	"find":   find,
+	"grep":   grep,
+	"ls":     ls,
+	"pwd":    pwd,
+	"whoami": whoami,
+}
+
+// flags will split the leading flags like -la from the rest of the arguments,
+// returning false if a flag is not one of the allowed
+func flags(proc *Proc, allowed string) (map[rune]bool, []string, bool) {
+	set, args := map[rune]bool{}, proc.Args[1:]
+	for ; len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-'; args = args[1:] {
+		for _, flag := range args[0][1:] {
+			if !strings.ContainsRune(allowed, flag) {
+				proc.Errorf("invalid option -- '%c'", flag)
+				return nil, nil, false
+			}
+			set[flag] = true
+		}
+	}
+	return set, args, true
+}
+
+func cat(proc *Proc) error {
+	if len(proc.Args) == 1 {
+		_, err := io.Copy(proc.Stdout, proc.Stdin)
+		return err
+	}
+	for _, name := range proc.Args[1:] {
+		if data, err := proc.Shell.ReadFile(name); err != nil {
+			proc.Errorf("%v: %v", name, err)
+		} else {
+			proc.Stdout.Write(data)
+		}
+	}
+	return nil
+}
+
+func cd(proc *Proc) error {
+	dir := proc.Shell.Home
+	if len(proc.Args) > 1 {
+		dir = proc.Args[1]
+	}
+	if file, err := proc.Shell.Stat(dir); err != nil {
+		proc.Errorf("%v: %v", dir, err)
+	} else if !file.IsDir() {
+		proc.Errorf("%v: %v", dir, ErrNotDir)
+	} else if !file.Can(proc.Shell.User, execBit) {
+		proc.Errorf("%v: %v", dir, ErrPermission)
+	} else {
+		proc.Shell.Cwd = proc.Shell.Abs(dir)
+	}
+	return nil
+}
+
+func echo(proc *Proc) error {
+	fmt.Fprintln(proc.Stdout, strings.Join(proc.Args[1:], " "))
+	return nil
+}
+
+func pwd(proc *Proc) error {
+	fmt.Fprintln(proc.Stdout, proc.Shell.Cwd)
+	return nil
+}
+
+func whoami(proc *Proc) error {
+	fmt.Fprintln(proc.Stdout, proc.Shell.User)
+	return nil
+}
+
+func ls(proc *Proc) error {
+	set, names, ok := flags(proc, "la")
+	if !ok {
+		return nil
+	} else if len(names) == 0 {
+		names = []string{"."}
+	}
+	for i, name := range names {
+		file, err := proc.Shell.Stat(name)
+		if err != nil {
+			proc.Errorf("%v: %v", name, err)
+			continue
+		}
+		files := []*File{file}
+		if file.IsDir() {
+			if !file.Can(proc.Shell.User, readBit) {
+				proc.Errorf("%v: %v", name, ErrPermission)
+				continue
+			}
+			files = []*File{}
+			for _, child := range file.Children() {
+				if set['a'] || !strings.HasPrefix(child.Name, ".") {
+					files = append(files, child)
+				}
+			}
+			if len(names) > 1 {
+				if i > 0 {
+					fmt.Fprintln(proc.Stdout)
+				}
+				fmt.Fprintf(proc.Stdout, "%v:\n", name)
+			}
+		}
+		if set['l'] {
+			longList(proc.Stdout, files)
+		} else {
+			for _, file := range files {
+				fmt.Fprintln(proc.Stdout, file.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// longList will print the files like ls -l, with the owner, group and size
+// columns lined up
+func longList(w io.Writer, files []*File) {
+	owner, group, size := 0, 0, 0
+	for _, file := range files {
+		if len(file.Owner) > owner {
+			owner = len(file.Owner)
+		}
+		if len(file.Group) > group {
+			group = len(file.Group)
+		}
+		if n := len(fmt.Sprint(file.Size())); n > size {
+			size = n
+		}
+	}
+	for _, file := range files {
+		fmt.Fprintf(w, "%v  1 %-*v  %-*v  %*v %v %v\n",
+			file.Mode, owner, file.Owner, group, file.Group, size, file.Size(),
+			file.ModTime.Format("Jan _2 15:04"), file.Name)
+	}
+}
+
+func find(proc *Proc) error {
+	roots, args := []string{}, proc.Args[1:]
+	for ; len(args) > 0 && !strings.HasPrefix(args[0], "-"); args = args[1:] {
+		roots = append(roots, args[0])
+	}
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	var namePattern, fileType string
+	for ; len(args) > 0; args = args[2:] {
+		if len(args) < 2 {
+			proc.Errorf("missing argument to `%v'", args[0])
+			return nil
+		} else if args[0] == "-name" {
+			namePattern = args[1]
+		} else if args[0] == "-type" && (args[1] == "f" || args[1] == "d") {
+			fileType = args[1]
+		} else {
+			proc.Errorf("unknown predicate `%v %v'", args[0], args[1])
+			return nil
+		}
+	}
+	var walk func(name string, file *File)
+	walk = func(name string, file *File) {
+		if matched, _ := path.Match(namePattern, file.Name); (namePattern == "" || matched) &&
+			(fileType == "" || (fileType == "d") == file.IsDir()) {
+			fmt.Fprintln(proc.Stdout, name)
+		}
+		if !file.IsDir() {
+			return
+		} else if !file.Can(proc.Shell.User, readBit) || !file.Can(proc.Shell.User, execBit) {
+			proc.Errorf("%v: %v", name, ErrPermission)
+			return
+		}
+		for _, child := range file.Children() {
+			walk(strings.TrimSuffix(name, "/")+"/"+child.Name, child)
+		}
+	}
+	for _, root := range roots {
+		if file, err := proc.Shell.Stat(root); err != nil {
+			proc.Errorf("%v: %v", root, err)
+		} else {
+			walk(root, file)
+		}
+	}
+	return nil
+}
+
+func grep(proc *Proc) error {
+	set, args, ok := flags(proc, "inv")
+	if !ok {
+		return nil
+	} else if len(args) == 0 {
+		fmt.Fprintln(proc.Stderr, "usage: grep [-inv] pattern [file ...]")
+		return nil
+	}
+	pattern := args[0]
+	if set['i'] {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		proc.Errorf("invalid pattern %v", args[0])
+		return nil
+	}
+	search := func(prefix string, r io.Reader) {
+		scanner := bufio.NewScanner(r)
+		for n := 1; scanner.Scan(); n++ {
+			if re.MatchString(scanner.Text()) == set['v'] {
+				continue
+			} else if set['n'] {
+				fmt.Fprintf(proc.Stdout, "%v%v:%v\n", prefix, n, scanner.Text())
+			} else {
+				fmt.Fprintf(proc.Stdout, "%v%v\n", prefix, scanner.Text())
+			}
+		}
+	}
+	if files := args[1:]; len(files) == 0 {
+		search("", proc.Stdin)
+	} else {
+		for _, name := range files {
+			data, err := proc.Shell.ReadFile(name)
+			if err != nil {
+				proc.Errorf("%v: %v", name, err)
+				continue
+			}
+			prefix := ""
+			if len(files) > 1 {
+				prefix = name + ":"
+			}
+			search(prefix, bytes.NewReader(data))
+		}
+	}
+	return nil
+}
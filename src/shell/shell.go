@@ -0,0 +1,150 @@
+// Package shell is a fake shell for puzzles that happen over ssh. It has an in
+// memory filesystem that can be looked around with ls, cat, cd, pwd, find and
+// grep, and stages can add their own commands and hook into file reads.
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+type (
+	// Command is something that can be run in the shell. Failures should be
+	// written to the proc's Stderr, returning an error ends the session.
+	Command func(proc *Proc) error
+	// Proc is a single run of a command. Args[0] is the name of the command and
+	// Stdin is the output of the command before it in a pipeline.
+	Proc struct {
+		Shell  *Shell
+		Args   []string
+		Stdin  io.Reader
+		Stdout io.Writer
+		Stderr io.Writer
+	}
+	// Shell runs command lines for a single user against a filesystem. OnRead is
+	// called with the data of every file that a command reads, and can change
+	// what is read or stop it with an error.
+	Shell struct {
+		FS       *FS
+		User     string
+		Home     string
+		Cwd      string
+		OnRead   func(sh *Shell, name string, data []byte) ([]byte, error)
+		commands map[string]Command
+	}
+)
+
+// New will create a shell for the user that starts in their home directory,
+// with the built in commands ready to use
+func New(vfs *FS, user, home string) *Shell {
+	sh := &Shell{FS: vfs, User: user, Home: clean(home), Cwd: clean(home), commands: map[string]Command{}}
+	for name, cmd := range builtins {
+		sh.commands[name] = cmd
+	}
+	return sh
+}
+
+// Register will add a command to the shell, replacing a built in command with
+// the same name
+func (sh *Shell) Register(name string, cmd Command) {
+	sh.commands[name] = cmd
+}
+
+// Run will run a line of input, piping the output of each command into the
+// next and writing the output of the last to w. Only an error from a command
+// is returned, problems with the line itself are written to w.
+func (sh *Shell) Run(w io.Writer, line string) error {
+	pipeline, err := parse(line, sh.Home)
+	if err != nil {
+		fmt.Fprintf(w, "pb: %v\n", err)
+		return nil
+	}
+	var stdin io.Reader = strings.NewReader("")
+	for i, args := range pipeline {
+		cmd, ok := sh.commands[args[0]]
+		if !ok {
+			fmt.Fprintf(w, "pb: command not found: %v\n", args[0])
+			return nil
+		}
+		stdout, out := w, &bytes.Buffer{}
+		if i < len(pipeline)-1 {
+			stdout = out
+		}
+		if err := cmd(&Proc{Shell: sh, Args: args, Stdin: stdin, Stdout: stdout, Stderr: w}); err != nil {
+			return err
+		}
+		stdin = out
+	}
+	return nil
+}
+
+// Abs will resolve the path relative to the current directory
+func (sh *Shell) Abs(name string) string {
+	if path.IsAbs(name) {
+		return clean(name)
+	}
+	return clean(path.Join(sh.Cwd, name))
+}
+
+// Stat will return the file at the path if the user can get to it
+func (sh *Shell) Stat(name string) (*File, error) {
+	return sh.FS.Lookup(sh.Abs(name), sh.User)
+}
+
+// ReadFile will return the contents of the file if the user is allowed to read
+// it, passing it through OnRead first
+func (sh *Shell) ReadFile(name string) ([]byte, error) {
+	file, err := sh.Stat(name)
+	if err != nil {
+		return nil, err
+	} else if file.IsDir() {
+		return nil, ErrIsDir
+	} else if !file.Can(sh.User, readBit) {
+		return nil, ErrPermission
+	} else if sh.OnRead != nil {
+		return sh.OnRead(sh, sh.Abs(name), file.Data)
+	}
+	return file.Data, nil
+}
+
+// ReadDir will return the files in the directory if the user is allowed to
+// list it
+func (sh *Shell) ReadDir(name string) ([]*File, error) {
+	file, err := sh.Stat(name)
+	if err != nil {
+		return nil, err
+	} else if !file.IsDir() {
+		return nil, ErrNotDir
+	} else if !file.Can(sh.User, readBit) {
+		return nil, ErrPermission
+	}
+	return file.Children(), nil
+}
+
+// WriteFile will create or replace a file owned by the user, if they are
+// allowed to write to the directory and to the file that is already there
+func (sh *Shell) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	dir, err := sh.Stat(path.Dir(sh.Abs(name)))
+	if err != nil {
+		return err
+	} else if !dir.IsDir() {
+		return ErrNotDir
+	} else if !dir.Can(sh.User, writeBit) {
+		return ErrPermission
+	} else if file, err := sh.Stat(name); err == nil && file.IsDir() {
+		return ErrIsDir
+	} else if err == nil && !file.Can(sh.User, writeBit) {
+		return ErrPermission
+	}
+	_, err = sh.FS.WriteFile(sh.Abs(name), data, sh.User, perm)
+	return err
+}
+
+// Errorf will write a failure to stderr prefixed with the command name
+func (proc *Proc) Errorf(format string, a ...any) {
+	fmt.Fprintf(proc.Stderr, "%v: %v\n", proc.Args[0], fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,182 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testShell(t *testing.T) *Shell {
+	vfs := NewFS()
+	_, err := vfs.Mkdir("/root", "root", 0700)
+	assert.Nil(t, err)
+	modTime := time.Date(2023, time.September, 23, 20, 13, 0, 0, time.UTC)
+	for _, f := range []struct {
+		name, data, owner string
+		perm              fs.FileMode
+	}{
+		{"/home/player/readme.md", "the password is\nhunter2\n", "player", 0644},
+		{"/home/player/.hidden", "boo\n", "player", 0600},
+		{"/home/player/notes/todo.txt", "find the password\n", "player", 0644},
+		{"/root/secret.txt", "the cake is a lie\n", "root", 0600},
+		{"/etc/motd", "welcome\n", "root", 0640},
+	} {
+		file, err := vfs.WriteFile(f.name, []byte(f.data), f.owner, f.perm)
+		assert.Nil(t, err)
+		file.ModTime = modTime
+		dir, err := vfs.Stat(path.Dir(f.name))
+		assert.Nil(t, err)
+		dir.ModTime = modTime
+	}
+	return New(vfs, "player", "/home/player")
+}
+
+func run(t *testing.T, sh *Shell, line string) string {
+	var out bytes.Buffer
+	assert.Nil(t, sh.Run(&out, line))
+	return out.String()
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		line     string
+		pipeline [][]string
+		err      error
+	}{
+		{"", [][]string{}, nil},
+		{"ls -l", [][]string{{"ls", "-l"}}, nil},
+		{`cat  "my file.txt"  'it''s'`, [][]string{{"cat", "my file.txt", "its"}}, nil},
+		{`echo "say \"hi\"" a\ b 'no \escape'`, [][]string{{"echo", `say "hi"`, "a b", `no \escape`}}, nil},
+		{"cat a | grep x|wc", [][]string{{"cat", "a"}, {"grep", "x"}, {"wc"}}, nil},
+		{`echo "a | b"`, [][]string{{"echo", "a | b"}}, nil},
+		{`echo ""`, [][]string{{"echo", ""}}, nil},
+		{`echo "oops`, nil, errUnterminated},
+		{`echo oops\`, nil, errUnterminated},
+		{"| grep x", nil, errEmptyPipe},
+		{"ls |", nil, errEmptyPipe},
+	}
+	for _, c := range cases {
+		pipeline, err := Parse(c.line)
+		assert.Equal(t, c.err, err, c.line)
+		assert.Equal(t, c.pipeline, pipeline, c.line)
+	}
+}
+
+func TestLs(t *testing.T) {
+	sh := testShell(t)
+	assert.Equal(t, "notes\nreadme.md\n", run(t, sh, "ls"))
+	assert.Equal(t, ".hidden\nnotes\nreadme.md\n", run(t, sh, "ls -a"))
+	assert.Equal(t, `-rw-------  1 player  staff   4 Sep 23 20:13 .hidden
+drwxr-xr-x  1 player  staff   0 Sep 23 20:13 notes
+-rw-r--r--  1 player  staff  24 Sep 23 20:13 readme.md
+`, run(t, sh, "ls -la"))
+	assert.Equal(t, "ls: /root: permission denied\n", run(t, sh, "ls /root"))
+	assert.Equal(t, "ls: nope: no such file or directory\n", run(t, sh, "ls nope"))
+	assert.Equal(t, "ls: invalid option -- 'z'\n", run(t, sh, "ls -z"))
+	assert.Equal(t, "/etc:\nmotd\n\nnotes:\ntodo.txt\n", run(t, sh, "ls /etc notes"))
+}
+
+func TestCatCdPwd(t *testing.T) {
+	sh := testShell(t)
+	assert.Equal(t, "the password is\nhunter2\n", run(t, sh, "cat readme.md"))
+	assert.Equal(t, "cat: /root/secret.txt: permission denied\n", run(t, sh, "cat /root/secret.txt"))
+	assert.Equal(t, "cat: /etc/motd: permission denied\n", run(t, sh, "cat /etc/motd"))
+	assert.Equal(t, "cat: notes: is a directory\n", run(t, sh, "cat notes"))
+	assert.Equal(t, "", run(t, sh, "cd notes"))
+	assert.Equal(t, "/home/player/notes\n", run(t, sh, "pwd"))
+	assert.Equal(t, "find the password\nthe password is\nhunter2\n", run(t, sh, "cat todo.txt ../readme.md"))
+	assert.Equal(t, "cd: /root: permission denied\n", run(t, sh, "cd /root"))
+	assert.Equal(t, "cd: todo.txt: not a directory\n", run(t, sh, "cd todo.txt"))
+	assert.Equal(t, "", run(t, sh, "cd"))
+	assert.Equal(t, "/home/player\n", run(t, sh, "pwd"))
+	assert.Equal(t, "", run(t, sh, "cd ~/notes/.."))
+	assert.Equal(t, "/home/player\n", run(t, sh, "pwd"))
+
+	sh.User = "root"
+	assert.Equal(t, "the cake is a lie\n", run(t, sh, "cat /root/secret.txt"))
+}
+
+func TestFind(t *testing.T) {
+	sh := testShell(t)
+	assert.Equal(t, ".\n./.hidden\n./notes\n./notes/todo.txt\n./readme.md\n", run(t, sh, "find"))
+	assert.Equal(t, "/home/player/notes/todo.txt\n/home/player/readme.md\n", run(t, sh, "find ~ -type f -name '*.*' | grep -v hidden"))
+	assert.Equal(t, "~/readme.md\n", run(t, sh, "echo '~/readme.md'"))
+	assert.Equal(t, "/root\nfind: /root: permission denied\n", run(t, sh, "find /root"))
+	assert.Equal(t, "find: unknown predicate `-size 1k'\n", run(t, sh, "find -size 1k"))
+}
+
+func TestGrep(t *testing.T) {
+	sh := testShell(t)
+	assert.Equal(t, "the password is\n", run(t, sh, "grep -i PASS readme.md"))
+	assert.Equal(t, "2:hunter2\n", run(t, sh, "grep -nv password readme.md"))
+	assert.Equal(t, "readme.md:the password is\nnotes/todo.txt:find the password\n", run(t, sh, "grep password readme.md notes/todo.txt"))
+	assert.Equal(t, "hunter2\n", run(t, sh, "cat readme.md | grep hunter | cat"))
+	assert.Equal(t, "usage: grep [-inv] pattern [file ...]\n", run(t, sh, "grep"))
+}
+
+func TestRunCommands(t *testing.T) {
+	sh := testShell(t)
+	assert.Equal(t, "pb: command not found: login\n", run(t, sh, "login hunter2"))
+	assert.Equal(t, "pb: unexpected end of line, a quote was not closed\n", run(t, sh, "echo 'hi"))
+
+	errLoggedIn := errors.New("logged in")
+	sh.Register("login", func(proc *Proc) error {
+		if len(proc.Args) > 1 && proc.Args[1] == "hunter2" {
+			return errLoggedIn
+		}
+		proc.Errorf("wrong password")
+		return nil
+	})
+	sh.Register("shout", func(proc *Proc) error {
+		var buf bytes.Buffer
+		buf.ReadFrom(proc.Stdin)
+		proc.Stdout.Write([]byte(strings.ToUpper(buf.String())))
+		return nil
+	})
+	assert.Equal(t, "login: wrong password\n", run(t, sh, "login nope"))
+	assert.Equal(t, errLoggedIn, sh.Run(&bytes.Buffer{}, "login hunter2"))
+	assert.Equal(t, "HUNTER2\n", run(t, sh, "grep hunter readme.md | shout"))
+	assert.Equal(t, "player\n", run(t, sh, "whoami"))
+}
+
+func TestOnRead(t *testing.T) {
+	sh := testShell(t)
+	read := []string{}
+	sh.OnRead = func(sh *Shell, name string, data []byte) ([]byte, error) {
+		read = append(read, name)
+		if strings.HasSuffix(name, "todo.txt") {
+			return nil, errors.New("it ran away")
+		}
+		return bytes.ReplaceAll(data, []byte("hunter2"), []byte("*******")), nil
+	}
+	assert.Equal(t, "the password is\n*******\n", run(t, sh, "cat readme.md"))
+	assert.Equal(t, "cat: notes/todo.txt: it ran away\n", run(t, sh, "cat notes/todo.txt"))
+	assert.Equal(t, []string{"/home/player/readme.md", "/home/player/notes/todo.txt"}, read)
+}
+
+func TestReadDirWriteFile(t *testing.T) {
+	sh := testShell(t)
+	files, err := sh.ReadDir(".")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{".hidden", "notes", "readme.md"}, []string{files[0].Name, files[1].Name, files[2].Name})
+	_, err = sh.ReadDir("/root")
+	assert.True(t, errors.Is(err, fs.ErrPermission))
+	_, err = sh.ReadDir("readme.md")
+	assert.Equal(t, ErrNotDir, err)
+
+	assert.Nil(t, sh.WriteFile("answer.txt", []byte("42\n"), 0600))
+	assert.Equal(t, "42\n", run(t, sh, "cat answer.txt"))
+	file, err := sh.Stat("answer.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "player", file.Owner)
+	assert.Equal(t, fs.FileMode(0600), file.Info().Mode())
+	assert.Equal(t, ErrPermission, sh.WriteFile("/etc/passwd", nil, 0644))
+	assert.Equal(t, ErrIsDir, sh.WriteFile("notes", nil, 0644))
+	assert.True(t, errors.Is(sh.WriteFile("/nope/answer.txt", nil, 0644), fs.ErrNotExist))
+}
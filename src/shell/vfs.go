@@ -0,0 +1,191 @@
+package shell
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// FS is an in memory filesystem of directories and files with owners and
+	// permissions that a Shell can look around. Once it is set up it can be
+	// shared between shells.
+	FS struct {
+		mx   sync.RWMutex
+		root *File
+	}
+	// File is a file or directory in an FS
+	File struct {
+		Name     string
+		Mode     fs.FileMode
+		Owner    string
+		Group    string
+		ModTime  time.Time
+		Data     []byte
+		children map[string]*File
+	}
+
+	// fileInfo is a File as an fs.FileInfo
+	fileInfo struct {
+		file *File
+	}
+	// fsError is an error with the wording of a shell that still matches the
+	// errors of the fs package with errors.Is
+	fsError struct {
+		msg string
+		err error
+	}
+)
+
+const (
+	rootUser     = "root"
+	defaultGroup = "staff"
+	readBit      = 4
+	writeBit     = 2
+	execBit      = 1
+)
+
+var (
+	// ErrNotExist is returned when there is nothing at a path
+	ErrNotExist error = fsError{"no such file or directory", fs.ErrNotExist}
+	// ErrPermission is returned when the user is not allowed to read a file or
+	// go into a directory
+	ErrPermission error = fsError{"permission denied", fs.ErrPermission}
+	// ErrNotDir is returned when a file is used as a directory
+	ErrNotDir = errors.New("not a directory")
+	// ErrIsDir is returned when a directory is used as a file
+	ErrIsDir = errors.New("is a directory")
+)
+
+// NewFS will create a filesystem with just the root directory
+func NewFS() *FS {
+	return &FS{root: &File{Name: "/", Mode: fs.ModeDir | 0755, Owner: rootUser, Group: defaultGroup, children: map[string]*File{}}}
+}
+
+// Mkdir will create the directory and any parents that do not exist yet, owned
+// by the owner
+func (vfs *FS) Mkdir(name, owner string, perm fs.FileMode) (*File, error) {
+	vfs.mx.Lock()
+	defer vfs.mx.Unlock()
+	return vfs.mkdir(name, owner, perm)
+}
+
+// WriteFile will create or replace the file, creating any parent directories
+// that do not exist yet
+func (vfs *FS) WriteFile(name string, data []byte, owner string, perm fs.FileMode) (*File, error) {
+	vfs.mx.Lock()
+	defer vfs.mx.Unlock()
+	dir, err := vfs.mkdir(path.Dir(clean(name)), owner, 0755)
+	if err != nil {
+		return nil, err
+	}
+	base := path.Base(clean(name))
+	if existing, ok := dir.children[base]; ok && existing.IsDir() {
+		return nil, ErrIsDir
+	}
+	file := &File{Name: base, Mode: perm.Perm(), Owner: owner, Group: defaultGroup, ModTime: time.Now(), Data: data}
+	dir.children[base] = file
+	dir.ModTime = file.ModTime
+	return file, nil
+}
+
+// Stat will return the file at the path without checking any permissions
+func (vfs *FS) Stat(name string) (*File, error) {
+	return vfs.Lookup(name, rootUser)
+}
+
+// Lookup will return the file at the path as long as the user is allowed to go
+// through every directory on the way to it
+func (vfs *FS) Lookup(name, user string) (*File, error) {
+	vfs.mx.RLock()
+	defer vfs.mx.RUnlock()
+	file := vfs.root
+	for _, part := range split(name) {
+		if !file.IsDir() {
+			return nil, ErrNotDir
+		} else if !file.Can(user, execBit) {
+			return nil, ErrPermission
+		} else if file = file.children[part]; file == nil {
+			return nil, ErrNotExist
+		}
+	}
+	return file, nil
+}
+
+func (vfs *FS) mkdir(name, owner string, perm fs.FileMode) (*File, error) {
+	dir := vfs.root
+	for _, part := range split(name) {
+		child, ok := dir.children[part]
+		if !ok {
+			child = &File{Name: part, Mode: fs.ModeDir | perm.Perm(), Owner: owner, Group: defaultGroup, ModTime: time.Now(), children: map[string]*File{}}
+			dir.children[part] = child
+		} else if !child.IsDir() {
+			return nil, ErrNotDir
+		}
+		dir = child
+	}
+	return dir, nil
+}
+
+// IsDir will return true if the file is a directory
+func (file *File) IsDir() bool {
+	return file.Mode.IsDir()
+}
+
+// Size is the length of the file's data
+func (file *File) Size() int {
+	return len(file.Data)
+}
+
+// Children will return the files in a directory sorted by name
+func (file *File) Children() []*File {
+	children := make([]*File, 0, len(file.children))
+	for _, child := range file.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	return children
+}
+
+// Can will check the permission bits, read is 4, write is 2 and execute is 1,
+// for the user.
+// The owner's bits apply to the owner, everyone else gets the other bits and
+// root can do anything.
+func (file *File) Can(user string, bit fs.FileMode) bool {
+	if user == rootUser {
+		return true
+	} else if user == file.Owner {
+		return file.Mode.Perm()&(bit<<6) != 0
+	}
+	return file.Mode.Perm()&bit != 0
+}
+
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
+
+func split(name string) []string {
+	if name = strings.Trim(clean(name), "/"); name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// Info will return the file as an fs.FileInfo
+func (file *File) Info() fs.FileInfo {
+	return fileInfo{file: file}
+}
+
+func (info fileInfo) Name() string       { return info.file.Name }
+func (info fileInfo) Size() int64        { return int64(info.file.Size()) }
+func (info fileInfo) Mode() fs.FileMode  { return info.file.Mode }
+func (info fileInfo) ModTime() time.Time { return info.file.ModTime }
+func (info fileInfo) IsDir() bool        { return info.file.IsDir() }
+func (info fileInfo) Sys() any           { return info.file }
+
+func (err fsError) Error() string { return err.msg }
+func (err fsError) Unwrap() error { return err.err }
@@ -0,0 +1,123 @@
+package stages
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tanema/pb/src/artifacts"
+	"github.com/tanema/pb/src/term"
+)
+
+// printArtifacts will print the paths of everything that pb has created, and
+// anything that is still running, or the whole manifest with --json. With
+// --verify each artifact is checked against what was recorded when it was
+// created and it is an error if any have changed.
+func printArtifacts(in *term.Input) error {
+	if in.Opts.Bool("stop") {
+		return stopArtifacts(in)
+	} else if !in.Opts.Bool("json") && !in.Opts.Bool("verify") {
+		artifacts.Print(in.Stdout, in.DB)
+		return printLive(in)
+	}
+	all := artifacts.List(in.DB)
+	if in.Opts.Bool("verify") {
+		all = artifacts.Verify(all)
+	}
+	if in.Opts.Bool("json") {
+		enc := json.NewEncoder(in.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(all); err != nil {
+			return err
+		}
+	} else {
+		for _, artf := range all {
+			fmt.Fprintf(in.Stdout, "%-8s  %v\n", artf.Status, artf.Path)
+		}
+	}
+	changed := 0
+	for _, artf := range all {
+		if artf.Status != "" && artf.Status != artifacts.StatusOK {
+			changed++
+		}
+	}
+	if changed > 0 {
+		return fmt.Errorf("%v of the artifacts have been modified or are missing", changed)
+	}
+	return nil
+}
+
+func printLive(in *term.Input) error {
+	live := artifacts.Live(in.DB)
+	if len(live) == 0 {
+		return nil
+	}
+	in.Println(`
+{{"still running"|warning}}:`, nil)
+	for _, artf := range live {
+		fmt.Fprintf(in.Stderr, "  %-8s %v (pid %v)\n", artf.Kind, artf.Path, artf.PID)
+	}
+	return in.Println(`stop them with {{"pb --artifacts --stop"|command}}`, nil)
+}
+
+// stopArtifacts will interrupt every process that is holding on to an
+// ephemeral artifact, they release their artifacts as they shut down.
+func stopArtifacts(in *term.Input) error {
+	live := artifacts.Live(in.DB)
+	if len(live) == 0 {
+		return in.Println("Nothing is running.", nil)
+	}
+	stopped := map[int]bool{}
+	for _, artf := range live {
+		if stopped[artf.PID] {
+			continue
+		} else if err := artifacts.Stop(artf); err != nil {
+			return err
+		}
+		stopped[artf.PID] = true
+		fmt.Fprintf(in.Stderr, "stopped pid %v\n", artf.PID)
+	}
+	return nil
+}
+
+// clean will remove everything that pb has created after showing the player
+// what will be removed and asking them to confirm, unless --yes was passed.
+// Only artifacts within where pb saves its data and installs its manpage and
+// completions are removed.
+func clean(in *term.Input) error {
+	all := artifacts.List(in.DB, append(completionDirs(in), in.DB.Dir(), in.Env.ManDir)...)
+	if len(all) == 0 {
+		return in.Println("There is nothing to clean up.", nil)
+	}
+	in.Println(`{{"pb"|bold}} will remove:`, nil)
+	for _, artf := range all {
+		if artf.Allowed {
+			fmt.Fprintf(in.Stderr, "  %8s  %v\n", formatSize(artf.Size), artf.Path)
+		} else {
+			in.Println(`  {{"skipping"|warning}}  {{.}}, it is outside of where pb makes things`, artf.Path)
+		}
+	}
+	if !in.Opts.Bool("yes") && !in.Confirm("Remove these?") {
+		return in.Println("Nothing was removed.", nil)
+	}
+	for _, artf := range all {
+		if !artf.Allowed {
+			continue
+		} else if err := artifacts.Clean(in.DB, artf); err != nil {
+			return err
+		}
+	}
+	return in.Println(`All cleaned up, thanks for playing.`, nil)
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
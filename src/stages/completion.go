@@ -0,0 +1,125 @@
+package stages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tanema/pb/src/artifacts"
+	"github.com/tanema/pb/src/stages/registry"
+	"github.com/tanema/pb/src/term"
+)
+
+type completionInfo struct {
+	Name string
+	Func string
+}
+
+var (
+	completionScripts = map[string]string{
+		"bash": completionBash,
+		"zsh":  completionZsh,
+		"fish": completionFish,
+	}
+	nonIdent = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// printCompletion will print the completion script for the shell, or install it
+// where the shell will load it with --install.
+func printCompletion(in *term.Input, stage stageInfo) error {
+	shell := ""
+	if len(in.Opts.Args) > 1 {
+		shell = in.Opts.Args[1]
+	}
+	tmpl, ok := completionScripts[shell]
+	if !ok {
+		return in.Errorf(`pick a shell, {{"pb completion bash|zsh|fish"|command}}`, nil)
+	}
+	name := filepath.Base(in.Name)
+	script := in.Sprintf(tmpl, completionInfo{Name: name, Func: nonIdent.ReplaceAllString(name, "_")})
+	if !in.Opts.Bool("install") {
+		_, err := fmt.Fprint(in.Stdout, script)
+		return err
+	}
+	path := completionPath(in, shell, name)
+	if path == "" {
+		return fmt.Errorf("could not find where %v loads completions from", shell)
+	} else if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	} else if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		return err
+	}
+	artifacts.Add(in.DB, artifacts.KindFile, path, stage.ID)
+	in.Println(`Completion for {{.}} installed, open a new shell to use it.`, shell)
+	if shell == "zsh" {
+		in.Println(`Make sure it is in your fpath before compinit:
+    fpath=({{.}} $fpath)`, filepath.Dir(path))
+	}
+	return nil
+}
+
+// completionPath is where the shell will load the completion script for the
+// command from
+func completionPath(in *term.Input, shell, name string) string {
+	dataHome := dataHome(in)
+	configHome := in.Env.Store.ConfigHome
+	if configHome == "" && in.Env.Home != "" {
+		configHome = filepath.Join(in.Env.Home, ".config")
+	}
+	if shell == "bash" && dataHome != "" {
+		return filepath.Join(dataHome, "bash-completion", "completions", name)
+	} else if shell == "zsh" && dataHome != "" {
+		return filepath.Join(dataHome, "zsh", "site-functions", "_"+name)
+	} else if shell == "fish" && configHome != "" {
+		return filepath.Join(configHome, "fish", "completions", name+".fish")
+	}
+	return ""
+}
+
+// completionDirs are the directories completion scripts are installed to so that
+// they can be cleaned up
+func completionDirs(in *term.Input) []string {
+	dirs := []string{}
+	for shell := range completionScripts {
+		if path := completionPath(in, shell, filepath.Base(in.Name)); path != "" {
+			dirs = append(dirs, filepath.Dir(path))
+		}
+	}
+	return dirs
+}
+
+// complete is called by the completion scripts with the words on the command
+// line, the last being the word being completed. It prints the candidates for
+// that word from the options of the current stage, and the stage itself if it
+// is a Completer.
+func complete(in *term.Input, stage stageInfo) error {
+	words, word := in.Opts.Args[1:], ""
+	if len(words) > 0 {
+		words, word = words[:len(words)-1], words[len(words)-1]
+	}
+	candidates := []string{}
+	if len(words) == 1 && words[0] == "completion" {
+		for shell := range completionScripts {
+			candidates = append(candidates, shell)
+		}
+	} else if strings.HasPrefix(word, "-") {
+		for _, opt := range append(globalOptions, stage.Options()...) {
+			candidates = append(candidates, strings.Fields(opt.Flag())...)
+		}
+	} else if len(words) == 0 {
+		candidates = append(candidates, "completion")
+	}
+	if completer, ok := stage.Stage.(registry.Completer); ok {
+		candidates = append(candidates, completer.Complete(words, word)...)
+	}
+	sort.Strings(candidates)
+	for i, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) && (i == 0 || candidate != candidates[i-1]) {
+			fmt.Fprintln(in.Stdout, candidate)
+		}
+	}
+	return nil
+}
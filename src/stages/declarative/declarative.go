@@ -0,0 +1,227 @@
+package declarative
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tanema/pb/src/stages/registry"
+	"github.com/tanema/pb/src/term"
+	"github.com/tanema/pb/src/util"
+)
+
+type (
+	// Definition is a stage described by data instead of code. It is loaded from
+	// a yaml or json file and executed by a generic Stage. Completions are
+	// offered when the player presses tab so that they can reveal things that are
+	// not in the usage.
+	Definition struct {
+		ID          string        `yaml:"id" json:"id"`
+		Number      int           `yaml:"number" json:"number"`
+		Prev        string        `yaml:"prev" json:"prev"`
+		Next        string        `yaml:"next" json:"next"`
+		Title       string        `yaml:"title" json:"title"`
+		Man         string        `yaml:"man" json:"man"`
+		Usage       string        `yaml:"usage" json:"usage"`
+		Hints       []string      `yaml:"hints" json:"hints"`
+		Options     []term.Option `yaml:"options" json:"options"`
+		Rules       []Rule        `yaml:"rules" json:"rules"`
+		Completions []string      `yaml:"completions" json:"completions"`
+	}
+	// Rule is checked against the input and the first one that matches will have
+	// its response executed. If a counter is set, the key in the DB will count
+	// how many times the rule has matched and choose a response from the steps,
+	// repeating the last step once they run out.
+	Rule struct {
+		When     Matcher    `yaml:"when" json:"when"`
+		Counter  string     `yaml:"counter" json:"counter"`
+		Steps    []Response `yaml:"steps" json:"steps"`
+		Response `yaml:",inline"`
+	}
+	// Matcher describes the input that a rule will respond to. Every field that
+	// is set has to match, and an empty matcher will match anything. Values are
+	// templates rendered with the user's environment.
+	Matcher struct {
+		None  bool     `yaml:"none" json:"none"`
+		Args  []string `yaml:"args" json:"args"`
+		Flags []string `yaml:"flags" json:"flags"`
+		Opts  []string `yaml:"opts" json:"opts"`
+		All   []string `yaml:"all" json:"all"`
+	}
+	// Response is what a stage does when a rule matches. Print, Error and set
+	// values are templates rendered with the user's environment. After setting
+	// and printing, only the first of Usage, Error or Advance will take effect.
+	Response struct {
+		Print   string            `yaml:"print" json:"print"`
+		Error   string            `yaml:"error" json:"error"`
+		Set     map[string]string `yaml:"set" json:"set"`
+		Usage   bool              `yaml:"usage" json:"usage"`
+		Advance bool              `yaml:"advance" json:"advance"`
+	}
+	// Stage runs a declarative definition
+	Stage struct {
+		in  *term.Input
+		def *Definition
+	}
+)
+
+//go:embed stages
+var stageFiles embed.FS
+
+func init() {
+	if err := RegisterFS(stageFiles); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterFS will parse all of the stage definitions in the file system and
+// register them as stages.
+func RegisterFS(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		def, err := Parse(name, src)
+		if err != nil {
+			return err
+		}
+		Register(def)
+		return nil
+	})
+}
+
+// Register will add the definition to the stage registry
+func Register(def *Definition) {
+	registry.Register(registry.Definition{
+		ID:     def.ID,
+		Number: def.Number,
+		Prev:   def.Prev,
+		Next:   def.Next,
+		New:    func(in *term.Input) registry.Stage { return New(in, def) },
+	})
+}
+
+// Parse will decode a stage definition, the format is decided by the file
+// extension of the name.
+func Parse(name string, src []byte) (*Definition, error) {
+	def := &Definition{}
+	switch path.Ext(name) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(src))
+		dec.KnownFields(true)
+		if err := dec.Decode(def); err != nil {
+			return nil, fmt.Errorf("%v: %w", name, err)
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(src))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(def); err != nil {
+			return nil, fmt.Errorf("%v: %w", name, err)
+		}
+	default:
+		return nil, fmt.Errorf("%v: unknown stage format", name)
+	}
+	if def.ID == "" {
+		return nil, fmt.Errorf("%v: stage is missing an id", name)
+	}
+	for i, rule := range def.Rules {
+		if rule.Counter != "" && len(rule.Steps) == 0 {
+			return nil, fmt.Errorf("%v: rule %v has a counter but no steps", name, i)
+		} else if rule.Counter == "" && len(rule.Steps) > 0 {
+			return nil, fmt.Errorf("%v: rule %v has steps but no counter", name, i)
+		}
+	}
+	return def, nil
+}
+
+// New will create a stage that runs the definition
+func New(in *term.Input, def *Definition) *Stage {
+	return &Stage{in: in, def: def}
+}
+
+func (stage *Stage) Title() string          { return stage.def.Title }
+func (stage *Stage) Man() string            { return stage.def.Man }
+func (stage *Stage) Help() string           { return stage.in.Sprintf(stage.def.Usage, stage.in.Env) }
+func (stage *Stage) Hints() []string        { return stage.def.Hints }
+func (stage *Stage) Options() []term.Option { return stage.def.Options }
+
+func (stage *Stage) Complete(args []string, word string) []string {
+	return stage.render(stage.def.Completions)
+}
+
+func (stage *Stage) Run() error {
+	for _, rule := range stage.def.Rules {
+		if stage.matches(rule.When) {
+			return stage.respond(rule)
+		}
+	}
+	return errors.New("no idea what you are trying to do")
+}
+
+func (stage *Stage) matches(when Matcher) bool {
+	if when.None && !stage.in.None() {
+		return false
+	} else if len(when.Args) > 0 && !stage.in.HasArgs(stage.render(when.Args)...) {
+		return false
+	} else if len(when.Flags) > 0 && !stage.in.HasFlags(stage.render(when.Flags)...) {
+		return false
+	} else if len(when.Opts) > 0 && !stage.in.HasOpt(stage.render(when.Opts)...) {
+		return false
+	}
+	for _, opt := range stage.render(when.All) {
+		if !stage.in.HasOpt(opt) {
+			return false
+		}
+	}
+	return true
+}
+
+func (stage *Stage) render(tmpls []string) []string {
+	out := make([]string, len(tmpls))
+	for i, tmpl := range tmpls {
+		out[i] = stage.in.Sprintf(tmpl, stage.in.Env)
+	}
+	return out
+}
+
+func (stage *Stage) respond(rule Rule) error {
+	if rule.Counter == "" {
+		return stage.execute(rule.Response)
+	}
+	count := stage.in.State().Int(rule.Counter)
+	if count >= len(rule.Steps)-1 {
+		return stage.execute(rule.Steps[len(rule.Steps)-1])
+	} else if err := stage.in.State().SetInt(rule.Counter, count+1); err != nil {
+		return err
+	}
+	return stage.execute(rule.Steps[count])
+}
+
+func (stage *Stage) execute(resp Response) error {
+	for key, val := range resp.Set {
+		if err := stage.in.State().Set(key, stage.in.Sprintf(val, stage.in.Env)); err != nil {
+			return err
+		}
+	}
+	if resp.Print != "" {
+		stage.in.Println(resp.Print, stage.in.Env)
+	}
+	if resp.Usage {
+		return util.ErrorShowUsage
+	} else if resp.Error != "" {
+		return stage.in.Errorf(resp.Error, stage.in.Env)
+	} else if resp.Advance {
+		return util.SetStage(registry.Next(stage.def.ID), "")
+	}
+	return nil
+}
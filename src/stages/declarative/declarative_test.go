@@ -0,0 +1,68 @@
+package declarative
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tanema/pb/src/term"
+)
+
+func TestParse(t *testing.T) {
+	def, err := Parse("stage.yaml", []byte(`
+id: test
+number: 7
+prev: before
+title: A Test
+options:
+  - name: go
+    aliases: [g]
+    usage: do the thing
+  - name: times
+    type: int
+rules:
+  - when: {opts: [go]}
+    print: went
+    advance: true
+  - error: nope
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, "test", def.ID)
+	assert.Equal(t, 7, def.Number)
+	assert.Equal(t, "before", def.Prev)
+	assert.Equal(t, []term.Option{
+		{Name: "go", Aliases: []string{"g"}, Usage: "do the thing"},
+		{Name: "times", Type: term.OptInt},
+	}, def.Options)
+	assert.Equal(t, []string{"go"}, def.Rules[0].When.Opts)
+	assert.Equal(t, "went", def.Rules[0].Print)
+	assert.True(t, def.Rules[0].Advance)
+	assert.Equal(t, "nope", def.Rules[1].Error)
+
+	def, err = Parse("stage.json", []byte(`{"id": "test", "rules": [{"counter": "n", "steps": [{"print": "one"}, {"error": "two"}]}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "n", def.Rules[0].Counter)
+	assert.Equal(t, "two", def.Rules[0].Steps[1].Error)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse("stage.toml", []byte(`id = "test"`))
+	assert.EqualError(t, err, "stage.toml: unknown stage format")
+
+	_, err = Parse("stage.yaml", []byte(`title: no id`))
+	assert.EqualError(t, err, "stage.yaml: stage is missing an id")
+
+	_, err = Parse("stage.yaml", []byte("id: test\nrules:\n  - prnt: typo"))
+	assert.NotNil(t, err)
+
+	_, err = Parse("stage.json", []byte(`{"id": "test", "rules": [{"counter": "n"}]}`))
+	assert.EqualError(t, err, "stage.json: rule 0 has a counter but no steps")
+}
+
+func TestComplete(t *testing.T) {
+	def, err := Parse("stage.yaml", []byte("id: test\ncompletions: ['--{{.User}}-secret']"))
+	assert.Nil(t, err)
+	in, err := term.NewInput(term.Config{Env: map[string]string{"USER": "tim", "PB_STORE": "memory"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--tim-secret"}, New(in, def).Complete(nil, "--"))
+}
@@ -13,6 +13,7 @@ import (
 	"golang.org/x/exp/slices"
 
 	"github.com/tanema/pb/src/lisp"
+	"github.com/tanema/pb/src/stages/registry"
 	"github.com/tanema/pb/src/term"
 	"github.com/tanema/pb/src/util"
 )
@@ -21,16 +22,30 @@ type LispStage struct {
 	in         *term.Input
 	man, usage string
 	hints      []string
+	touched    int
 }
 
-const pinNumber = "4921"
+const (
+	// ID is the registry ID of the stage
+	ID        = "lisp"
+	pinNumber = "4921"
+)
 
 var (
 	order      = []string{"blue", "green", "yellow", "red"}
 	pinNumbers = strings.Split(pinNumber, "")
-	touched    = 0
 )
 
+func init() {
+	registry.Register(registry.Definition{
+		ID:     ID,
+		Number: 3,
+		Prev:   "waitforinfo",
+		Next:   "merrygoround",
+		New:    func(in *term.Input) registry.Stage { return New(in) },
+	})
+}
+
 func New(in *term.Input) *LispStage {
 	return &LispStage{
 		in: in,
@@ -38,39 +53,44 @@ func New(in *term.Input) *LispStage {
 
 This will challenge you to use programming with very little.
 
-Check out {{"https://lisp-lang.org/"|cyan|underline}} to get started.`,
+Check out {{"https://lisp-lang.org/"|link}} to get started.`,
 		man: `Do you think this area will give you more help? Unfortunately there is nothing
 here for you.
 
 Maybe look at https://lisp-lang.org/ `,
 		hints: []string{
 			`it's lisp, don't think too hard but think with prefixes`,
-			`check out the {{"(help)" | cyan}} output`,
-			`how could you combine {{"touch" | cyan}} calls into a single line of code?`,
-			`what does {{"touch" | cyan}} output? Is it the same every time?`,
-			`{{"(print (str 4) (str (+ 1 1)))" | cyan}}`,
+			`check out the {{"(help)" | command}} output`,
+			`how could you combine {{"touch" | command}} calls into a single line of code?`,
+			`what does {{"touch" | command}} output? Is it the same every time?`,
+			`{{"(print (str 4) (str (+ 1 1)))" | command}}`,
 		},
 	}
 }
 
-func (stage *LispStage) Title() string              { return "Speech Impediment" }
-func (stage *LispStage) Man() string                { return stage.man }
-func (stage *LispStage) Help() string               { return stage.usage }
-func (stage *LispStage) Hints() []string            { return stage.hints }
-func (stage *LispStage) Options() map[string]string { return nil }
+func (stage *LispStage) Title() string          { return "Speech Impediment" }
+func (stage *LispStage) Man() string            { return stage.man }
+func (stage *LispStage) Help() string           { return stage.usage }
+func (stage *LispStage) Hints() []string        { return stage.hints }
+func (stage *LispStage) Options() []term.Option { return nil }
 
 func (stage *LispStage) Run() error {
 	puzzleEnv := lisp.NewEnv(map[string]any{
-		"help":   help,
-		"look":   look,
-		"touch":  touch,
-		"unlock": stage.unlock,
+		"help":      stage.help,
+		"look":      look,
+		"touch":     stage.touch,
+		"unlock":    stage.unlock,
+		lisp.Stdout: stage.in.Stdout,
 	})
 
 	if stage.in.HasPipe {
-		return evalSrc(puzzleEnv, string(stage.in.Stdin))
-	} else if len(stage.in.Args) > 0 {
-		file, err := os.Open(stage.in.Args[0])
+		src, err := stage.in.ReadStdin()
+		if err != nil {
+			return err
+		}
+		return evalSrc(puzzleEnv, string(src))
+	} else if len(stage.in.Opts.Args) > 0 {
+		file, err := os.Open(stage.in.Opts.Args[0])
 		if err != nil {
 			return err
 		}
@@ -81,7 +101,7 @@ func (stage *LispStage) Run() error {
 		}
 		return evalSrc(puzzleEnv, string(src))
 	}
-	return repl(puzzleEnv)
+	return stage.repl(puzzleEnv)
 }
 
 func evalSrc(env map[string]any, src string) error {
@@ -89,12 +109,12 @@ func evalSrc(env map[string]any, src string) error {
 	return err
 }
 
-func repl(env map[string]any) error {
-	term.Println(`This is a terrible implementation of {{"ANSI Common Lisp"|bold}} with little
+func (stage *LispStage) repl(env map[string]any) error {
+	stage.in.Println(`This is a terrible implementation of {{"ANSI Common Lisp"|bold}} with little
 to no functionality.
 
-For more information, you can use the {{"(help)"|cyan}} function and see documentation on
-defined functions with {{"(doc [fname])"|cyan}}.
+For more information, you can use the {{"(help)"|command}} function and see documentation on
+defined functions with {{"(doc [fname])"|command}}.
 
 It is free software, provided as is, with absolutely no warranty,
 and no guarantees. Good luck, god speed.`, nil)
@@ -103,6 +123,7 @@ and no guarantees. Good luck, god speed.`, nil)
 	if err != nil {
 		return err
 	}
+	defer rl.Close()
 
 	buf := bytes.NewBuffer(nil)
 	twice := 0
@@ -112,50 +133,52 @@ and no guarantees. Good luck, god speed.`, nil)
 			if err == readline.ErrInterrupt && twice < 1 {
 				buf.Reset()
 				rl.SetPrompt("> ")
-				term.Println(`Press {{"ctrl-c"|cyan}} twice to exit.`, nil)
+				stage.in.Println(`Press {{"ctrl-c"|command}} twice to exit.`, nil)
 				twice++
 			} else if err == readline.ErrInterrupt && twice >= 1 {
 				break
 			} else {
-				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(stage.in.Stderr, err)
 			}
 			continue
 		}
 		twice = 0
 		buf.WriteString(text + " ")
 		val, err := lisp.EvalSrc(env, buf.String())
-		if err == lisp.ErrorUnderflow {
+		if _, ok := err.(*util.StageChange); ok {
+			return err
+		} else if err == lisp.ErrorUnderflow {
 			rl.SetPrompt("...> ")
 		} else {
 			rl.SetPrompt("> ")
 			buf.Reset()
 			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(stage.in.Stderr, err)
 			} else {
-				fmt.Fprintln(os.Stdout, val)
+				fmt.Fprintln(stage.in.Stdout, val)
 			}
 		}
-		if touched > 0 {
-			term.Println(`you hear a loud {{"ka-thunk"| red}}! something fell back into place.`, nil)
-			touched = 0
+		if stage.touched > 0 {
+			stage.in.Println(`you hear a loud {{"ka-thunk"|danger}}! something fell back into place.`, nil)
+			stage.touched = 0
 		}
 	}
 	return nil
 }
 
-func help(env map[string]any, args []any) (any, error) {
-	return term.Sprintf(`This is a limited implementation of lisp. You are able to explore more
+func (stage *LispStage) help(env map[string]any, args []any) (any, error) {
+	return stage.in.Sprintf(`This is a limited implementation of lisp. You are able to explore more
 functionality a few ways.
 
 {{"env"|bold}}:    Use the env function to see all of the defined symbols within
         the current environment. This is good for finding what functionalities
-        that you have access to. usage: {{"(env)"|cyan}}
+        that you have access to. usage: {{"(env)"|command}}
 
 {{"doc"|bold}}:    Use the doc function to see per-function documentation, to see
-        usage and what they do. usage: {{"(doc funcName)"|cyan}}
+        usage and what they do. usage: {{"(doc funcName)"|command}}
 
 {{"unlock"|bold}}: This is your target. This is the function that you need to unlock the
-        next stage of the puzzle box. usage: {{"(unlock pinNumber)"|cyan}}
+        next stage of the puzzle box. usage: {{"(unlock pinNumber)"|command}}
 
 Some other funcs you might want to look at are {{"look"|bold}} and {{"touch"|bold}}`, nil), nil
 }
@@ -196,7 +219,7 @@ Usage: (look "direction")`, nil
 	return nil, nil
 }
 
-func touch(env map[string]any, args []any) (any, error) {
+func (stage *LispStage) touch(env map[string]any, args []any) (any, error) {
 	if lisp.IsDocCall(env, args) {
 		return `touch will allow you to touch an item around you.`, nil
 	} else if len(args) == 0 {
@@ -212,9 +235,9 @@ func touch(env map[string]any, args []any) (any, error) {
 			return nil, errors.New("I was expecting a string, cannot touch something that doesnt make sense")
 		}
 		color = strings.Split(color, " ")[0]
-		if slices.Contains(order, color) && order[touched] == color {
-			touched++
-			return pinNumbers[touched-1], nil
+		if slices.Contains(order, color) && stage.touched < len(order) && order[stage.touched] == color {
+			stage.touched++
+			return pinNumbers[stage.touched-1], nil
 		} else if slices.Contains(order, color) {
 			return "x", nil
 		} else {
@@ -242,13 +265,12 @@ func (stage *LispStage) unlock(env map[string]any, args []any) (any, error) {
 			}
 			pin = fmt.Sprintf("%v", pinNm)
 		}
-		if pin == pinNumber && touched == 4 {
-			term.Println(`{{"congrats"|bold}}, you have unlocked the next stage!`, nil)
-			util.SetStage(stage.in, "merrygoround")
-		} else if pin == pinNumber && touched != 4 {
+		if pin == pinNumber && stage.touched == 4 {
+			return nil, util.SetStage(registry.Next(ID), `{{"congrats"|bold}}, you have unlocked the next stage!`)
+		} else if pin == pinNumber && stage.touched != 4 {
 			return nil, errors.New("the pin does nothing without the buttons in place")
 		} else if pin != pinNumber {
-			return nil, errors.New(term.Sprintf("{{. | red}} is incorrect", pin))
+			return nil, stage.in.Errorf("{{. | danger}} is incorrect", pin)
 		}
 	}
 	return nil, nil
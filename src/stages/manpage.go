@@ -0,0 +1,78 @@
+package stages
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/tanema/pb/src/artifacts"
+	"github.com/tanema/pb/src/term"
+)
+
+// installManpage will write the manpage for the stage where man can find it. If
+// the system man directory cannot be written to, it falls back to the player's
+// data directory. It returns where the manpage is, or an empty string if it
+// could not be installed anywhere.
+func installManpage(in *term.Input, stage stageInfo) string {
+	content := []byte(in.Sprintf(manPage, stage))
+	for i, dir := range manDirs(in) {
+		path := filepath.Join(dir, "pb.1")
+		existing, err := os.ReadFile(path)
+		if err == nil && bytes.Equal(existing, content) {
+			artifacts.Add(in.DB, artifacts.KindFile, path, stage.ID)
+			return path
+		} else if err := os.MkdirAll(dir, 0755); err != nil {
+			continue
+		} else if err := os.WriteFile(path, content, 0644); err != nil {
+			continue
+		}
+		artifacts.Add(in.DB, artifacts.KindFile, path, stage.ID)
+		if manRoot := filepath.Dir(dir); i > 0 && existing == nil && !inManpath(in, manRoot) {
+			in.Println(`The manual was installed to {{.}}, add it to your MANPATH to read it with {{"man pb"|command}}
+    export MANPATH="{{.}}:$MANPATH"`, manRoot)
+		}
+		return path
+	}
+	return ""
+}
+
+// manDirs are the directories that the manpage can be installed to in the
+// order they are tried
+func manDirs(in *term.Input) []string {
+	if dataHome := dataHome(in); dataHome != "" {
+		return []string{in.Env.ManDir, filepath.Join(dataHome, "man", "man1")}
+	}
+	return []string{in.Env.ManDir}
+}
+
+// dataHome is where the player's data files go, $XDG_DATA_HOME or its default
+func dataHome(in *term.Input) string {
+	if in.Env.DataHome == "" && in.Env.Home != "" {
+		return filepath.Join(in.Env.Home, ".local", "share")
+	}
+	return in.Env.DataHome
+}
+
+func inManpath(in *term.Input, dir string) bool {
+	for _, path := range filepath.SplitList(in.Env.ManPath) {
+		if filepath.Clean(path) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// showManpage will open the manpage with man when it is available, otherwise it
+// renders the manpage itself.
+func showManpage(in *term.Input, stage stageInfo, path string) error {
+	if man, err := exec.LookPath("man"); err == nil && path != "" && in.IsTTY {
+		cmd := exec.Command(man, path)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, in.Stdout, in.Stderr
+		return cmd.Run()
+	}
+	_, err := fmt.Fprint(in.Stdout, in.RenderRoff(strings.TrimSpace(in.Sprintf(manPage, stage))+"\n"))
+	return err
+}
@@ -2,21 +2,37 @@ package merry
 
 import (
 	_ "embed"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/tanema/pb/src/crypto"
+	"github.com/tanema/pb/src/stages/registry"
 	"github.com/tanema/pb/src/term"
 	"github.com/tanema/pb/src/util"
 )
 
+// ID is the registry ID of the stage
+const ID = "merrygoround"
+
 type MerryStage struct {
 	in    *term.Input
 	usage string
 	hints []string
 }
 
+func init() {
+	registry.Register(registry.Definition{
+		ID:     ID,
+		Number: 4,
+		Prev:   "lisp",
+		Next:   "next",
+		New:    func(in *term.Input) registry.Stage { return New(in) },
+	})
+}
+
 func New(in *term.Input) *MerryStage {
 	return &MerryStage{
 		in: in,
@@ -31,26 +47,24 @@ to you differently depending on how you speak to it.`,
 	}
 }
 
-func (stage *MerryStage) Title() string              { return "Merry-Go-Round" }
-func (stage *MerryStage) Man() string                { return stage.usage }
-func (stage *MerryStage) Help() string               { return stage.usage }
-func (stage *MerryStage) Hints() []string            { return stage.hints }
-func (stage *MerryStage) Options() map[string]string { return nil }
+func (stage *MerryStage) Title() string          { return "Merry-Go-Round" }
+func (stage *MerryStage) Man() string            { return stage.usage }
+func (stage *MerryStage) Help() string           { return stage.usage }
+func (stage *MerryStage) Hints() []string        { return stage.hints }
+func (stage *MerryStage) Options() []term.Option { return nil }
 
 func (stage *MerryStage) Run() error {
-	if !stage.in.DB.Key("current_app_name") {
-		stage.in.DB.Set("current_app_name", os.Args[0])
+	if !stage.in.State().Key("current_app_name") {
+		stage.in.State().Set("current_app_name", stage.in.Name)
 	}
 
-	if stage.in.DB.Get("current_app_name") != os.Args[0] {
-		fmt.Println("you have done it! I have transformed! You have now completed the puzzle box.")
-		util.SetStage(stage.in, "next")
-		return nil
-	} else if !stage.in.None() && len(stage.in.Stdin) == 0 {
-		return term.Errorf(`not like that, speak to me like we are on {{"Love is Blind"|magenta}}`, nil)
+	if stage.in.State().Get("current_app_name") != stage.in.Name {
+		return util.SetStage(registry.Next(ID), "you have done it! I have transformed! You have now completed the puzzle box.")
+	} else if !stage.in.None() && !stage.in.HasPipe {
+		return stage.in.Errorf(`not like that, speak to me like we are on {{"Love is Blind"|hint}}`, nil)
 	} else if key, err := crypto.LoadKey(stage.in.DB); err != nil {
 		return err
-	} else if len(stage.in.Stdin) > 0 {
+	} else if stage.in.HasPipe {
 		return stage.consume(key)
 	} else {
 		return stage.puke(key)
@@ -60,17 +74,24 @@ func (stage *MerryStage) Run() error {
 func (stage *MerryStage) puke(key *crypto.EncryptionKey) error {
 	cipher, err := key.Encrypt([]byte("rename me and you will release me!"))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
 		return err
 	}
-	fmt.Print(util.Base64(string(cipher)))
+	fmt.Fprint(stage.in.Stdout, util.Base64(string(cipher)))
 	return nil
 }
 
+// consume will decode the first message piped in as it streams so that it does
+// not have to wait for the pipe to close.
 func (stage *MerryStage) consume(key *crypto.EncryptionKey) error {
-	cipherText, err := util.DecodeBase64(string(stage.in.Stdin))
-	if err != nil {
+	var cipherText json.RawMessage
+	var corrupt base64.CorruptInputError
+	err := json.NewDecoder(base64.NewDecoder(base64.StdEncoding, stage.in.Stdin)).Decode(&cipherText)
+	if errors.Is(err, io.EOF) {
+		return stage.in.Errorf(`not like that, speak to me like we are on {{"Love is Blind"|hint}}`, nil)
+	} else if errors.As(err, &corrupt) {
 		return errors.New("this is not base64!")
+	} else if errors.Is(err, term.ErrStdinTooLarge) || errors.Is(err, term.ErrStdinTimeout) {
+		return err
 	}
 	text, err := key.Decrypt(cipherText)
 	if err != nil {
@@ -3,16 +3,29 @@ package next
 import (
 	_ "embed"
 
+	"github.com/tanema/pb/src/stages/registry"
 	"github.com/tanema/pb/src/term"
 	"github.com/tanema/pb/src/util"
 )
 
+// ID is the registry ID of the stage
+const ID = "next"
+
 type NextStage struct {
 	in    *term.Input
 	usage string
 	hints []string
 }
 
+func init() {
+	registry.Register(registry.Definition{
+		ID:     ID,
+		Number: 5,
+		Prev:   "merrygoround",
+		New:    func(in *term.Input) registry.Stage { return New(in) },
+	})
+}
+
 func New(in *term.Input) *NextStage {
 	return &NextStage{
 		in:    in,
@@ -21,9 +34,9 @@ func New(in *term.Input) *NextStage {
 	}
 }
 
-func (stage *NextStage) Title() string              { return "Next Up" }
-func (stage *NextStage) Man() string                { return stage.usage }
-func (stage *NextStage) Help() string               { return stage.usage }
-func (stage *NextStage) Hints() []string            { return stage.hints }
-func (stage *NextStage) Options() map[string]string { return nil }
-func (stage *NextStage) Run() error                 { return util.ErrorShowUsage }
+func (stage *NextStage) Title() string          { return "Next Up" }
+func (stage *NextStage) Man() string            { return stage.usage }
+func (stage *NextStage) Help() string           { return stage.usage }
+func (stage *NextStage) Hints() []string        { return stage.hints }
+func (stage *NextStage) Options() []term.Option { return nil }
+func (stage *NextStage) Run() error             { return util.ErrorShowUsage }
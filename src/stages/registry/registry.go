@@ -0,0 +1,159 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/tanema/pb/src/term"
+)
+
+type (
+	// Stage is a single puzzle within the puzzle box
+	Stage interface {
+		Run() error
+		Title() string
+		Man() string
+		Help() string
+		Options() []term.Option
+		Hints() []string
+	}
+	// Exiter can be implemented by a stage that needs to clean up after it has
+	// been solved, like shutting down servers.
+	Exiter interface {
+		Exit() error
+	}
+	// Completer can be implemented by a stage to offer its own candidates when
+	// the player presses tab, like a secret option that is not in the usage. It
+	// is given the words before the one being completed and the word so far.
+	Completer interface {
+		Complete(args []string, word string) []string
+	}
+	// Definition describes a stage and where it sits in the stage graph
+	Definition struct {
+		ID     string
+		Number int
+		Prev   string
+		Next   string
+		Meta   map[string]string
+		New    func(*term.Input) Stage
+	}
+)
+
+var (
+	mx   sync.Mutex
+	defs = map[string]*Definition{}
+)
+
+// Register will add a stage definition to the registry. It is meant to be
+// called from the init func of a stage package and will panic if the definition
+// is incomplete or if the ID has already been registered.
+func Register(def Definition) {
+	mx.Lock()
+	defer mx.Unlock()
+	if def.ID == "" {
+		panic("registry: stage registered without an ID")
+	} else if def.New == nil {
+		panic(fmt.Sprintf("registry: stage %q registered without a constructor", def.ID))
+	} else if _, ok := defs[def.ID]; ok {
+		panic(fmt.Sprintf("registry: stage %q registered twice", def.ID))
+	}
+	defs[def.ID] = &def
+}
+
+// Get will return the definition registered with the ID
+func Get(id string) (*Definition, bool) {
+	mx.Lock()
+	defer mx.Unlock()
+	def, ok := defs[id]
+	return def, ok
+}
+
+// First will return the stage that a new player starts on, the one without a
+// predecessor. It will return nil if nothing has been registered.
+func First() *Definition {
+	if ordered := Ordered(); len(ordered) > 0 {
+		return ordered[0]
+	}
+	return nil
+}
+
+// Next will return the ID of the stage that follows the stage with the ID. If
+// there is no following stage, an empty string is returned.
+func Next(id string) string {
+	if def, ok := Get(id); ok {
+		return def.Next
+	}
+	return ""
+}
+
+// Ordered will return all the definitions ordered by walking the stage graph
+// from the first stage. Stages that are not reachable from the first stage are
+// appended in order of their display number.
+func Ordered() []*Definition {
+	mx.Lock()
+	defer mx.Unlock()
+	all := []*Definition{}
+	for _, def := range defs {
+		all = append(all, def)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Number == all[j].Number {
+			return all[i].ID < all[j].ID
+		}
+		return all[i].Number < all[j].Number
+	})
+
+	ordered := []*Definition{}
+	seen := map[string]bool{}
+	for _, def := range all {
+		if def.Prev != "" {
+			continue
+		}
+		for cur := def; cur != nil && !seen[cur.ID]; cur = defs[cur.Next] {
+			seen[cur.ID] = true
+			ordered = append(ordered, cur)
+		}
+	}
+	for _, def := range all {
+		if !seen[def.ID] {
+			ordered = append(ordered, def)
+		}
+	}
+	return ordered
+}
+
+// Validate will check that the registered stages form a single chain where
+// every predecessor and successor exists and agrees with its neighbour.
+func Validate() error {
+	ordered := Ordered()
+	if len(ordered) == 0 {
+		return fmt.Errorf("no stages registered")
+	}
+	firsts := 0
+	numbers := map[int]string{}
+	for _, def := range ordered {
+		if def.Prev == "" {
+			firsts++
+		} else if prev, ok := Get(def.Prev); !ok {
+			return fmt.Errorf("stage %q follows unknown stage %q", def.ID, def.Prev)
+		} else if prev.Next != def.ID {
+			return fmt.Errorf("stage %q follows %q but %q leads to %q", def.ID, def.Prev, def.Prev, prev.Next)
+		}
+		if def.Next != "" {
+			if next, ok := Get(def.Next); !ok {
+				return fmt.Errorf("stage %q leads to unknown stage %q", def.ID, def.Next)
+			} else if next.Prev != def.ID {
+				return fmt.Errorf("stage %q leads to %q but %q follows %q", def.ID, def.Next, def.Next, next.Prev)
+			}
+		}
+		if other, ok := numbers[def.Number]; ok {
+			return fmt.Errorf("stages %q and %q share the number %v", other, def.ID, def.Number)
+		}
+		numbers[def.Number] = def.ID
+	}
+	if firsts != 1 {
+		return fmt.Errorf("expected exactly one first stage but found %v", firsts)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tanema/pb/src/term"
+)
+
+func reset(all ...Definition) {
+	defs = map[string]*Definition{}
+	for _, def := range all {
+		def.New = func(*term.Input) Stage { return nil }
+		Register(def)
+	}
+}
+
+func TestOrdered(t *testing.T) {
+	reset(
+		Definition{ID: "c", Number: 3, Prev: "b"},
+		Definition{ID: "a", Number: 1, Next: "b"},
+		Definition{ID: "b", Number: 2, Prev: "a", Next: "c"},
+	)
+	ids := []string{}
+	for _, def := range Ordered() {
+		ids = append(ids, def.ID)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, ids)
+	assert.Equal(t, "a", First().ID)
+	assert.Equal(t, "c", Next("b"))
+	assert.Equal(t, "", Next("c"))
+	assert.Nil(t, Validate())
+}
+
+func TestValidate(t *testing.T) {
+	reset()
+	assert.NotNil(t, Validate())
+
+	reset(Definition{ID: "a", Number: 1, Next: "missing"})
+	assert.EqualError(t, Validate(), `stage "a" leads to unknown stage "missing"`)
+
+	reset(
+		Definition{ID: "a", Number: 1, Next: "b"},
+		Definition{ID: "b", Number: 2},
+	)
+	assert.EqualError(t, Validate(), `stage "a" leads to "b" but "b" follows ""`)
+
+	reset(
+		Definition{ID: "a", Number: 1},
+		Definition{ID: "b", Number: 1},
+	)
+	assert.EqualError(t, Validate(), `stages "a" and "b" share the number 1`)
+}
+
+func TestRegisterTwice(t *testing.T) {
+	reset(Definition{ID: "a"})
+	assert.Panics(t, func() { Register(Definition{ID: "a", New: func(*term.Input) Stage { return nil }}) })
+}
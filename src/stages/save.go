@@ -0,0 +1,67 @@
+package stages
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/tanema/pb/src/crypto"
+	"github.com/tanema/pb/src/pstore"
+	"github.com/tanema/pb/src/stages/registry"
+	"github.com/tanema/pb/src/term"
+)
+
+// exportSave will print the player's progress as a bundle that can be imported
+// again later. Artifacts and keys are tied to this machine so only the stage
+// progress is exported.
+func exportSave(in *term.Input) error {
+	encoded, err := crypto.EncodeBundle(in.DB.Export(pstore.StageNS))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(in.Stdout, encoded)
+	return nil
+}
+
+// importSave will replace the player's progress with an exported bundle, read
+// from the file passed with --import=path or --import path, or piped in. Anyone
+// can make a bundle so only its stage is imported, and only if the player has
+// already made it that far with this save.
+func importSave(in *term.Input) error {
+	var encoded []byte
+	path := in.Opts.String("import")
+	if path == "" && len(in.Opts.Args) > 0 {
+		path = in.Opts.Args[0]
+	}
+	var err error
+	if path != "" {
+		encoded, err = os.ReadFile(path)
+	} else if in.HasPipe {
+		encoded, err = in.ReadStdin()
+	} else {
+		return in.Errorf(`pipe in a save from {{"pb --export"|command}} or use {{"pb --import=path"|command}}`, nil)
+	}
+	if err != nil {
+		return err
+	}
+	bundle, err := crypto.DecodeBundle(string(encoded))
+	if errors.Is(err, crypto.ErrDamaged) {
+		return errors.New("That save is damaged, the box won't accept it.")
+	} else if err != nil {
+		return err
+	} else if err := bundle.Migrate(); err != nil {
+		return err
+	}
+	stageKey := pstore.Key(pstore.StageNS, "stage")
+	def, ok := registry.Get(bundle.Data[stageKey])
+	if !ok {
+		return errors.New("That save is at a stage that doesn't exist, the box won't accept it.")
+	} else if def.Number > furthest(in).Number {
+		return errors.New("You haven't made it that far here, the box won't accept that save.")
+	}
+	bundle.Data = map[string]string{stageKey: def.ID}
+	if err := in.DB.Import(bundle, pstore.StageNS); err != nil {
+		return err
+	}
+	return in.Println(`Save imported, welcome back {{.User}}.`, in.Env)
+}
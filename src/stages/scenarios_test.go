@@ -0,0 +1,35 @@
+package stages_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tanema/pb/src/harness"
+)
+
+var update = flag.Bool("update", false, "update the scenario golden files")
+
+func TestScenarios(t *testing.T) {
+	scenarios, err := filepath.Glob(filepath.Join("testdata", "*.scenario"))
+	assert.Nil(t, err)
+	for _, path := range scenarios {
+		script, err := os.Open(path)
+		assert.Nil(t, err)
+		transcript, err := harness.New(t.TempDir()).Play(script)
+		script.Close()
+		assert.Nil(t, err, path)
+
+		golden := strings.TrimSuffix(path, ".scenario") + ".golden"
+		if *update {
+			assert.Nil(t, os.WriteFile(golden, []byte(transcript), 0644))
+		}
+		expected, err := os.ReadFile(golden)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), transcript, path)
+	}
+}
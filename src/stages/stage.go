@@ -2,28 +2,30 @@ package stages
 
 import (
 	_ "embed"
-	"errors"
 	"fmt"
-	"os"
 
 	"github.com/tanema/pb/src/artifacts"
-	"github.com/tanema/pb/src/stages/lisp"
-	"github.com/tanema/pb/src/stages/merry"
-	"github.com/tanema/pb/src/stages/next"
-	"github.com/tanema/pb/src/stages/start"
-	"github.com/tanema/pb/src/stages/wait"
+	"github.com/tanema/pb/src/pstore"
+	"github.com/tanema/pb/src/stages/registry"
 	"github.com/tanema/pb/src/term"
 	"github.com/tanema/pb/src/util"
+
+	// stages register themselves with the registry when imported
+	_ "github.com/tanema/pb/src/stages/declarative"
+	_ "github.com/tanema/pb/src/stages/lisp"
+	_ "github.com/tanema/pb/src/stages/merry"
+	_ "github.com/tanema/pb/src/stages/next"
+	_ "github.com/tanema/pb/src/stages/wait"
 )
 
 type (
-	Stage interface {
-		Run() error
-		Title() string
-		Man() string
-		Help() string
-		Options() map[string]string
-		Hints() []string
+	// Stage is a single puzzle within the puzzle box
+	Stage = registry.Stage
+	// stageInfo is the data passed to the usage and manpage templates
+	stageInfo struct {
+		Stage
+		*registry.Definition
+		Stages []*registry.Definition
 	}
 )
 
@@ -38,77 +40,157 @@ var (
 	meow string
 	//go:embed default/milk.tmpl
 	milk string
+	//go:embed default/completion.bash.tmpl
+	completionBash string
+	//go:embed default/completion.zsh.tmpl
+	completionZsh string
+	//go:embed default/completion.fish.tmpl
+	completionFish string
+
+	// globalOptions are the options that every stage has
+	globalOptions = []term.Option{
+		{Name: "help", Aliases: []string{"h"}},
+		{Name: "hint"},
+		{Name: "man"},
+		{Name: "reset"},
+		{Name: "artifacts"},
+		{Name: "json"},
+		{Name: "verify"},
+		{Name: "stop"},
+		{Name: "clean"},
+		{Name: "yes", Aliases: []string{"y"}},
+		{Name: "export"},
+		{Name: "import", Type: term.OptString, Optional: true},
+		{Name: "slot", Type: term.OptString},
+		{Name: "install"},
+	}
 )
 
+// Main will run the current stage and print any error it returns, returning
+// the exit status for the process
+func Main(in *term.Input) int {
+	if err := Run(in); err != nil {
+		fmt.Fprint(in.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
 // Run will find the current stage and run it
 func Run(in *term.Input) error {
-	handlers := map[string]Stage{
-		"start":        start.New(in),
-		"waitforinfo":  wait.New(in),
-		"lisp":         lisp.New(in),
-		"merrygoround": merry.New(in),
-		"next":         next.New(in),
+	if err := registry.Validate(); err != nil {
+		return err
+	}
+
+	def, ok := registry.Get(in.State().Get("stage"))
+	if !ok {
+		def = registry.First()
+	}
+	currentStage := stageInfo{
+		Stage:      def.New(in),
+		Definition: def,
+		Stages:     registry.Ordered(),
+	}
+	if err := in.ParseOpts(append(globalOptions, currentStage.Options()...)); err != nil {
+		return err
+	} else if command(in) == "__complete" {
+		return complete(in, currentStage)
 	}
 
 	artifacts.Setup(in.DB)
-	in.DB.Set("hint", "are you trying to cheat by looking at the data?")
-	if in.HasFlags("artifacts") {
-		artifacts.Print(in.DB)
-		return nil
-	} else if in.HasFlags("reset") {
-		for _, key := range in.DB.Keys() {
-			if key != "artifacts" {
-				if err := in.DB.Del(key); err != nil {
-					return err
-				}
-			}
-		}
-		return nil
+	if command(in) == "completion" {
+		return printCompletion(in, currentStage)
+	} else if in.Opts.Bool("artifacts") {
+		return printArtifacts(in)
+	} else if in.Opts.Bool("clean") {
+		return clean(in)
+	} else if in.Opts.Bool("reset") {
+		return in.State().Drop()
+	} else if in.Opts.Bool("export") {
+		return exportSave(in)
+	} else if in.Opts.Has("import") {
+		return importSave(in)
 	} else if in.HasOpt("moo", "cow") {
-		return term.Println(cow, nil)
+		return in.Println(cow, nil)
 	} else if in.HasOpt("meow", "cat", "kitty") {
-		return term.Println(meow, nil)
+		return in.Println(meow, nil)
 	} else if in.HasOpt("milk", "cheese") {
-		return term.Println(milk, nil)
-	}
-
-	if in.DB.Get("stage") == "" {
-		util.SetStage(in, "start")
+		return in.Println(milk, nil)
+	} else if !ok {
+		if err := setStage(in, def.ID); err != nil {
+			return err
+		}
 	}
-	currentStage := handlers[in.DB.Get("stage")]
 
-	if err := installManpage(in, currentStage); err != nil {
-		return err
-	} else if in.HasFlags("help", "h") {
+	manpath := installManpage(in, currentStage)
+	if in.Opts.Bool("man") {
+		return showManpage(in, currentStage, manpath)
+	} else if in.Opts.Bool("help") {
 		return printUsage(in, currentStage)
-	} else if in.HasFlags("hint") {
+	} else if in.Opts.Bool("hint") {
 		return printHint(in, currentStage)
 	} else if err := currentStage.Run(); err == util.ErrorShowUsage {
 		return printUsage(in, currentStage)
+	} else if change, ok := err.(*util.StageChange); ok {
+		return advance(in, currentStage, change)
 	} else if err != nil {
 		return err
 	}
 	return nil
 }
 
-func installManpage(in *term.Input, stage Stage) error {
-	file, err := os.Create("/usr/local/share/man/man1/pb.1")
-	if err != nil {
+// command is the first positional argument, which pb uses for commands that
+// are not part of any stage
+func command(in *term.Input) string {
+	if len(in.Opts.Args) > 0 {
+		return in.Opts.Args[0]
+	}
+	return ""
+}
+
+func setStage(in *term.Input, stage string) error {
+	if def, ok := registry.Get(stage); ok && def.Number > furthest(in).Number {
+		if err := in.DB.Namespace(pstore.SystemNS).Set("reached", stage); err != nil {
+			return err
+		}
+	}
+	if err := in.State().Set("stage", stage); err != nil {
 		return err
-	} else if _, err = file.Write([]byte(term.Sprintf(manPage, stage))); err != nil {
+	}
+	return in.State().SetInt("hints", 0)
+}
+
+// furthest is the furthest stage that the player has reached with this save,
+// it is kept through a reset so that progress can be imported back.
+func furthest(in *term.Input) *registry.Definition {
+	reached, ok := registry.Get(in.DB.Namespace(pstore.SystemNS).Get("reached"))
+	if current, found := registry.Get(in.State().Get("stage")); found && (!ok || current.Number > reached.Number) {
+		return current
+	} else if !ok {
+		return registry.First()
+	}
+	return reached
+}
+
+func advance(in *term.Input, stage stageInfo, change *util.StageChange) error {
+	if err := setStage(in, change.Stage); err != nil {
 		return err
+	} else if change.Message != "" {
+		in.Println(change.Message, in.Env)
+	}
+	if exiter, ok := stage.Stage.(registry.Exiter); ok {
+		return exiter.Exit()
 	}
-	artifacts.Add(in.DB, file.Name())
-	return file.Close()
+	return nil
 }
 
-func printUsage(in *term.Input, stage Stage) error {
-	return term.Println(usage, stage)
+func printUsage(in *term.Input, stage stageInfo) error {
+	return in.Println(usage, stage)
 }
 
-func printHint(in *term.Input, stage Stage) error {
+func printHint(in *term.Input, stage stageInfo) error {
 	hints := stage.Hints()
 	in.Hints = (in.Hints + 1) % len(hints)
-	in.DB.Set("hints", fmt.Sprintf("%v", in.Hints))
-	return errors.New(term.Sprintf(hints[in.Hints], nil))
+	in.State().SetInt("hints", in.Hints)
+	return in.Errorf(hints[in.Hints], nil)
 }
@@ -0,0 +1,357 @@
+package stages_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tanema/pb/src/artifacts"
+	"github.com/tanema/pb/src/crypto"
+	"github.com/tanema/pb/src/harness"
+	"github.com/tanema/pb/src/pstore"
+	"github.com/tanema/pb/src/term"
+)
+
+func TestPlaythrough(t *testing.T) {
+	h := harness.New(t.TempDir())
+	var puke string
+	steps := []struct {
+		name   string
+		run    func() harness.Result
+		status int
+		stdout string
+		stderr string
+		stage  string
+	}{
+		{
+			name:   "first run shows usage",
+			run:    func() harness.Result { return h.Run() },
+			stderr: "Stage : 1 of 5, Let's go to the movies.",
+			stage:  "start",
+		},
+		{
+			name:   "unknown input",
+			run:    func() harness.Result { return h.Run("open") },
+			status: 1,
+			stderr: "no idea what you are trying to do",
+			stage:  "start",
+		},
+		{
+			name:   "candy without swarm",
+			run:    func() harness.Result { return h.Run("--candy") },
+			status: 1,
+			stderr: "What do you want to do to the candy?",
+			stage:  "start",
+		},
+		{
+			name:   "swarm the candy",
+			run:    func() harness.Result { return h.Run("--candy", "--swarm") },
+			stderr: "you are now onto the second stage.",
+			stage:  "waitforinfo",
+		},
+		{
+			name:   "speak",
+			run:    func() harness.Result { return h.Run("--speak") },
+			status: 1,
+			stdout: "I dont feel so good, I think I might puuu:",
+			stderr: "TXkgcG9ydCBpcyAyMDIzLCBjYWxsIG1lIQ==",
+			stage:  "waitforinfo",
+		},
+		{
+			name: "login over ssh",
+			run: func() harness.Result {
+				proc := h.Start("--listen")
+				assert.Nil(t, harness.WaitForPort(h.Addr, 5*time.Second))
+				assert.Contains(t, h.Run("--artifacts").Stderr, "port     "+h.Addr)
+				out, err := harness.SSH(h.Addr, "cat readme.md", "login hackerman")
+				assert.Nil(t, err)
+				assert.Contains(t, out, "The password is 6861636b65726d616e")
+				return proc.Wait()
+			},
+			stderr: "You are now on logged into",
+			stage:  "lisp",
+		},
+		{
+			name: "listener released its artifacts",
+			run: func() harness.Result {
+				res := h.Run("--artifacts")
+				assert.NotContains(t, res.Stderr, "still running")
+				return res
+			},
+			stage: "lisp",
+		},
+		{
+			name:   "wrong pin",
+			run:    func() harness.Result { return h.Pipe(`(unlock 1234)`) },
+			status: 1,
+			stderr: "1234",
+			stage:  "lisp",
+		},
+		{
+			name: "unlock",
+			run: func() harness.Result {
+				return h.Pipe(`(unlock (str (touch "blue") (touch "green") (touch "yellow") (touch "red")))`)
+			},
+			stderr: "you have unlocked the next stage!",
+			stage:  "merrygoround",
+		},
+		{
+			name: "puke",
+			run: func() harness.Result {
+				res := h.Run()
+				puke = res.Stdout
+				return res
+			},
+			stage: "merrygoround",
+		},
+		{
+			name:   "consume",
+			run:    func() harness.Result { return h.Pipe(puke) },
+			status: 1,
+			stderr: "rename me and you will release me!",
+			stage:  "merrygoround",
+		},
+		{
+			name:   "renamed",
+			run:    func() harness.Result { return h.Exec(term.Config{Name: "bp"}) },
+			stderr: "You have now completed the puzzle box.",
+			stage:  "next",
+		},
+		{
+			name:   "next",
+			run:    func() harness.Result { return h.Run() },
+			stderr: "Stage : 5 of 5, Next Up",
+			stage:  "next",
+		},
+	}
+
+	for _, step := range steps {
+		res := step.run()
+		assert.Equal(t, step.status, res.Status, step.name)
+		assert.Contains(t, res.Stdout, step.stdout, step.name)
+		assert.Contains(t, res.Stderr, step.stderr, step.name)
+		assert.Equal(t, step.stage, h.Stage(), step.name)
+	}
+}
+
+func TestReset(t *testing.T) {
+	h := harness.New(t.TempDir())
+	h.Run("--candy", "--swarm")
+	assert.Equal(t, "waitforinfo", h.Stage())
+	assert.Equal(t, 0, h.Run("--reset").Status)
+	h.Run()
+	assert.Equal(t, "start", h.Stage())
+}
+
+func TestExportImport(t *testing.T) {
+	h := harness.New(t.TempDir())
+	h.Run("--candy", "--swarm")
+	assert.Equal(t, "waitforinfo", h.Stage())
+	res := h.Run("--export")
+	assert.Equal(t, 0, res.Status)
+	save := res.Stdout
+
+	laptop := harness.New(t.TempDir())
+	res = laptop.Pipe(save, "--import")
+	assert.Equal(t, 1, res.Status)
+	assert.Contains(t, res.Stderr, "haven't made it that far")
+	assert.Equal(t, "", laptop.Stage())
+
+	assert.Equal(t, 0, h.Run("--reset").Status)
+	res = h.Pipe(save, "--import")
+	assert.Equal(t, 0, res.Status)
+	assert.Contains(t, res.Stderr, "Save imported")
+	assert.Equal(t, "waitforinfo", h.Stage())
+
+	res = h.Pipe("bm90IGEgc2F2ZQ==", "--import")
+	assert.Equal(t, 1, res.Status)
+	assert.Contains(t, res.Stderr, "damaged")
+	assert.Equal(t, "waitforinfo", h.Stage())
+
+	forge := func(data map[string]string) string {
+		forged, err := crypto.EncodeBundle(&pstore.Bundle{Version: pstore.SchemaVersion(), Data: data})
+		assert.Nil(t, err)
+		return forged
+	}
+	res = h.Pipe(forge(map[string]string{"stage/stage": "finale"}), "--import")
+	assert.Contains(t, res.Stderr, "doesn't exist")
+	res = h.Pipe(forge(map[string]string{"stage/stage": "next"}), "--import")
+	assert.Contains(t, res.Stderr, "haven't made it that far")
+	assert.Equal(t, "waitforinfo", h.Stage())
+
+	res = h.Pipe(forge(map[string]string{"stage/stage": "start", "stage/candyman": "99"}), "--import")
+	assert.Equal(t, 0, res.Status)
+	assert.Equal(t, "start", h.Stage())
+	assert.False(t, h.DB.Namespace(pstore.StageNS).Key("candyman"))
+}
+
+func TestClean(t *testing.T) {
+	h := harness.New(t.TempDir())
+	h.Run()
+	manpage := filepath.Join(h.Env["PB_MAN_DIR"], "pb.1")
+	assert.FileExists(t, manpage)
+	artifacts.Add(h.DB, artifacts.KindFile, "/etc/passwd", "")
+
+	res := h.Pipe("n\n", "--clean")
+	assert.Contains(t, res.Stderr, manpage)
+	assert.Contains(t, res.Stderr, "/etc/passwd, it is outside of where pb makes things")
+	assert.Contains(t, res.Stderr, "Nothing was removed.")
+	assert.FileExists(t, manpage)
+
+	res = h.Run("--clean")
+	assert.Contains(t, res.Stderr, "Nothing was removed.")
+	res = h.Exec(term.Config{Args: []string{"--clean"}, Terminal: strings.NewReader("y\n")})
+	assert.Equal(t, 0, res.Status)
+	assert.Contains(t, res.Stderr, "All cleaned up")
+	assert.NoFileExists(t, manpage)
+	res = h.Run("--artifacts")
+	assert.Equal(t, "/etc/passwd", res.Stdout)
+}
+
+func TestManpage(t *testing.T) {
+	dir := t.TempDir()
+	h := harness.New(dir)
+	blocked := filepath.Join(dir, "blocked")
+	assert.Nil(t, os.WriteFile(blocked, nil, 0644))
+	h.Env["PB_MAN_DIR"] = filepath.Join(blocked, "man1")
+
+	res := h.Run()
+	assert.Equal(t, 0, res.Status)
+	assert.Contains(t, res.Stderr, `export MANPATH="`+filepath.Join(dir, ".local", "share", "man")+`:$MANPATH"`)
+	manpage := filepath.Join(dir, ".local", "share", "man", "man1", "pb.1")
+	info, err := os.Stat(manpage)
+	assert.Nil(t, err)
+
+	res = h.Run()
+	assert.NotContains(t, res.Stderr, "MANPATH")
+	again, err := os.Stat(manpage)
+	assert.Nil(t, err)
+	assert.Equal(t, info.ModTime(), again.ModTime())
+
+	res = h.Run("--man")
+	assert.Equal(t, 0, res.Status)
+	assert.Contains(t, term.StripANSI(res.Stdout), "NAME\n       pb\n           the command line puzzle box")
+}
+
+func TestSlotPlaythrough(t *testing.T) {
+	h := harness.New(t.TempDir())
+	assert.Nil(t, h.DB.Namespace(pstore.StageNS).Set("stage", "merrygoround"))
+	res := h.Run("--slot=alice")
+	assert.Equal(t, 0, res.Status)
+	assert.NotEmpty(t, res.Stdout)
+	res = h.Pipe(res.Stdout, "--slot", "alice")
+	assert.Contains(t, res.Stderr, "rename me and you will release me!")
+	h.Name = "bp"
+	res = h.Run("--slot", "alice")
+	assert.Equal(t, 0, res.Status)
+	assert.Equal(t, "next", h.Stage())
+}
+
+func TestSlots(t *testing.T) {
+	home := t.TempDir()
+	h := harness.New(home)
+	h.DB = nil
+	h.Env["PB_STORE"] = "file"
+	assert.Equal(t, 0, h.Run("--slot=alice", "--candy", "--swarm").Status)
+	assert.Equal(t, 0, h.Run("--slot", "bob").Status)
+	assert.Contains(t, h.Run("--slot=alice", "--help").Stderr, "Stage : 2 of 5")
+	assert.Contains(t, h.Run("--slot=bob", "--help").Stderr, "Stage : 1 of 5")
+	assert.Contains(t, h.Run("--help").Stderr, "Stage : 1 of 5")
+	assert.FileExists(t, filepath.Join(home, ".config", "pb", ".data.alice"))
+	assert.FileExists(t, filepath.Join(home, ".config", "pb", ".data.bob"))
+
+	res := h.Run("--slot=../x")
+	assert.Equal(t, 1, res.Status)
+	assert.Contains(t, res.Stderr, `invalid slot name "../x"`)
+	assert.NoFileExists(t, filepath.Join(home, ".config", "x"))
+
+	h.Env["PB_STORE"] = "memory"
+	res = h.Run("--slot=alice")
+	assert.Equal(t, 1, res.Status)
+	assert.Contains(t, res.Stderr, "can't be used with the memory store")
+}
+
+func TestOptionErrors(t *testing.T) {
+	h := harness.New(t.TempDir())
+	res := h.Run("--help=maybe")
+	assert.Equal(t, 1, res.Status)
+	assert.Contains(t, res.Stderr, `--help -h expects true or false but got "maybe"`)
+
+	res = h.Run("--slot")
+	assert.Equal(t, 1, res.Status)
+}
+
+func TestOpenPipe(t *testing.T) {
+	h := harness.New(t.TempDir())
+	stdin, pipe := io.Pipe()
+	defer pipe.Close()
+	done := make(chan harness.Result, 1)
+	go func() { done <- h.Exec(term.Config{Args: []string{"--help"}, Stdin: stdin}) }()
+	select {
+	case res := <-done:
+		assert.Equal(t, 0, res.Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pb waited for stdin that it did not need")
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	dir := t.TempDir()
+	h := harness.New(dir)
+	res := h.Run("__complete", "--", "--he")
+	assert.Equal(t, 0, res.Status)
+	assert.Equal(t, "--help\n", res.Stdout)
+	assert.Equal(t, "", h.Stage())
+
+	res = h.Run("__complete", "--", "--")
+	assert.Contains(t, res.Stdout, "--candy\n")
+	res = h.Run("__complete", "--", "completion", "")
+	assert.Equal(t, "bash\nfish\nzsh\n", res.Stdout)
+
+	assert.Nil(t, h.DB.Namespace(pstore.StageNS).Set("stage", "waitforinfo"))
+	res = h.Run("__complete", "--", "")
+	assert.Equal(t, "completion\nlisten\nspeak\n", res.Stdout)
+	res = h.Run("__complete", "--", "--li")
+	assert.Equal(t, "--listen\n", res.Stdout)
+	res = h.Run("__complete", "--", "listen", "")
+	assert.Equal(t, "", res.Stdout)
+
+	res = h.Run("completion", "bash")
+	assert.Equal(t, 0, res.Status)
+	assert.Contains(t, res.Stdout, "complete -o default -F _pb pb")
+	res = h.Run("completion", "tcsh")
+	assert.Equal(t, 1, res.Status)
+
+	res = h.Run("completion", "fish", "--install")
+	assert.Equal(t, 0, res.Status)
+	script := filepath.Join(dir, ".config", "fish", "completions", "pb.fish")
+	assert.FileExists(t, script)
+	assert.Contains(t, h.Run("--artifacts").Stdout, script)
+	h.Run("--clean", "--yes")
+	assert.NoFileExists(t, script)
+}
+
+func TestColor(t *testing.T) {
+	h := harness.New(t.TempDir())
+	res := h.Run("--help")
+	assert.NotContains(t, res.Stderr, "\033[")
+
+	h.IsTTY = true
+	res = h.Run("--help")
+	assert.Contains(t, res.Stderr, "\033[1mOPTIONS\033[m")
+
+	h.Env["NO_COLOR"] = "1"
+	res = h.Run("--help")
+	assert.NotContains(t, res.Stderr, "\033[")
+
+	delete(h.Env, "NO_COLOR")
+	h.Env["PB_THEME"] = "neon"
+	res = h.Run()
+	assert.Equal(t, 1, res.Status)
+	assert.Contains(t, res.Stderr, `unknown theme "neon"`)
+}
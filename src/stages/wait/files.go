@@ -0,0 +1,77 @@
+package wait
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/tanema/pb/src/artifacts"
+	"github.com/tanema/pb/src/server"
+)
+
+// sshFiles lets the player copy the files in the shell with scp and sftp, with
+// the same permissions that they have in the shell
+type sshFiles struct {
+	stage *WaitStage
+}
+
+func (files sshFiles) Home(sess *server.Session) string { return home }
+
+func (files sshFiles) Stat(sess *server.Session, name string) (fs.FileInfo, error) {
+	file, err := files.stage.shell(sess).Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return file.Info(), nil
+}
+
+func (files sshFiles) ReadDir(sess *server.Session, name string) ([]fs.FileInfo, error) {
+	children, err := files.stage.shell(sess).ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]fs.FileInfo, len(children))
+	for i, child := range children {
+		infos[i] = child.Info()
+	}
+	return infos, nil
+}
+
+func (files sshFiles) ReadFile(sess *server.Session, name string) ([]byte, error) {
+	return files.stage.shell(sess).ReadFile(name)
+}
+
+// WriteFile will put what the player uploaded into the shell and keep a copy in
+// the directory pb keeps its data in so that it can be looked at after the server
+// has stopped
+func (files sshFiles) WriteFile(sess *server.Session, name string, data []byte, perm fs.FileMode) error {
+	if err := files.stage.shell(sess).WriteFile(name, data, perm); err != nil {
+		return err
+	}
+	dataDir := files.stage.in.DB.Dir()
+	if dataDir == "" {
+		return nil
+	}
+	dir := filepath.Join(dataDir, "uploads")
+	dest := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	} else if err := os.WriteFile(dest, data, 0644); err != nil {
+		return err
+	}
+	artifacts.Add(files.stage.in.DB, artifacts.KindDir, dir, ID)
+	artifacts.Add(files.stage.in.DB, artifacts.KindFile, dest, ID)
+	return nil
+}
+
+// logTransfer will let the player know that their file made it
+func (stage *WaitStage) logTransfer(transfer server.Transfer) {
+	if transfer.Err != nil {
+		fmt.Fprintf(stage.in.Stdout, "%v could not copy %v: %v\n", transfer.Session.User, transfer.Path, transfer.Err)
+	} else if transfer.Upload {
+		fmt.Fprintf(stage.in.Stdout, "%v sent me %v over %v, thank you!\n", transfer.Session.User, transfer.Path, transfer.Protocol)
+	} else {
+		fmt.Fprintf(stage.in.Stdout, "%v took %v over %v, I hope you give it back.\n", transfer.Session.User, transfer.Path, transfer.Protocol)
+	}
+}
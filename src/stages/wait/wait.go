@@ -1,16 +1,24 @@
 package wait
 
 import (
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"path"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/tanema/pb/src/artifacts"
 	"github.com/tanema/pb/src/server"
+	"github.com/tanema/pb/src/shell"
+	"github.com/tanema/pb/src/stages/registry"
 	"github.com/tanema/pb/src/term"
 	"github.com/tanema/pb/src/util"
 )
@@ -20,36 +28,60 @@ type (
 		in         *term.Input
 		man, usage string
 		hints      []string
-		options    map[string]string
-	}
-	fileItem struct {
-		Owner string
-		Name  string
-		Day   int
-		Month string
-		Time  string
-		Size  string
+		options    []term.Option
+		srv        *server.Server
+		release    []func()
+		solved     chan error
+		vfs        *shell.FS
+		shells     sync.Map
 	}
 )
 
 const (
-	port     = "2023"
+	// ID is the registry ID of the stage
+	ID       = "waitforinfo"
 	password = "hackerman"
+	home     = "/home/timanema"
+	guest    = "guest"
+
+	shutdownTimeout = 5 * time.Second
+	// sigInfo is SIGINFO on BSD and macOS, it is not named everywhere
+	sigInfo = syscall.Signal(29)
 )
 
 var (
-	portMsg   = util.Base64("My port is %v, call me!", port)
 	passHex   = util.Hex(password)
 	passwdMsg = fmt.Sprintf("the password is: %s", passHex)
-	fileList  = `{{range . -}}
--rw-r--r--  1 {{.Owner | cyan}}  staff   {{.Size}} {{.Day}} {{.Month}} {{.Time}} {{.Name}}
-{{end}}`
-	fakefiles = []fileItem{
-		{Owner: "timanema", Name: "readme.md", Day: 23, Month: "Sep", Time: "20:13", Size: "5mb"},
-		{Owner: "root", Name: "note.txt", Day: 21, Month: "Sep", Time: "10:05", Size: "1mb"},
+	fakefiles = []struct {
+		name, data, owner string
+		modTime           time.Time
+	}{
+		{name: "readme.md", data: fmt.Sprintf("The password is %v\n", passHex), owner: "timanema", modTime: time.Date(2023, time.September, 23, 20, 13, 0, 0, time.UTC)},
+		{name: "note.txt", data: "not this file, the other.\n", owner: "root", modTime: time.Date(2023, time.September, 21, 10, 5, 0, 0, time.UTC)},
+	}
+	replies = map[string]string{
+		"su":      "We are confident, aren't we?",
+		"sudo":    "We are confident, aren't we?",
+		"rm":      "What exactly are you trying to acheive?",
+		"help":    "Try looking around.",
+		"look":    "This is not monkey island, this is a computer. Have you tried looking for INFO",
+		"hello":   "Yes, hello again.",
+		"hi":      "Yes, hello again.",
+		"2.14.98": "nope that is just a random number.",
+		"secret":  "not like that.",
 	}
 )
 
+func init() {
+	registry.Register(registry.Definition{
+		ID:     ID,
+		Number: 2,
+		Prev:   "start",
+		Next:   "lisp",
+		New:    func(in *term.Input) registry.Stage { return New(in) },
+	})
+}
+
 func New(in *term.Input) *WaitStage {
 	return &WaitStage{
 		in: in,
@@ -60,23 +92,32 @@ In this stage we will communicate in many ways.
 I will {{"listen"|bold}} to you, and if you want, I can {{"speak"|bold}} as well!`,
 		man: "So you think you are clever now because you got to the second step right?",
 		hints: []string{
-			`{{"base64 -d" | cyan}} will be your friend.`,
-			`you might need to use {{"ssh" | magenta}}.`,
-			`do you know linux tools like {{"ls" | cyan}} and {{"cat" | cyan}}?`,
-			`do you know what {{"SIGINFO" | yellow}} is?`,
+			`{{"base64 -d" | command}} will be your friend.`,
+			`you might need to use {{"ssh" | hint}}.`,
+			`do you know linux tools like {{"ls" | command}} and {{"cat" | command}}?`,
+			`do you know what {{"SIGINFO" | hint}} is?`,
 		},
-		options: map[string]string{
-			"--listen": "Let me listen to what you have to say.",
-			"--speak":  "You listen to what I have to say",
+		options: []term.Option{
+			{Name: "listen", Usage: "Let me listen to what you have to say."},
+			{Name: "speak", Usage: "You listen to what I have to say"},
 		},
 	}
 }
 
-func (stage *WaitStage) Title() string              { return "A Conversation" }
-func (stage *WaitStage) Man() string                { return stage.man }
-func (stage *WaitStage) Help() string               { return stage.usage }
-func (stage *WaitStage) Hints() []string            { return stage.hints }
-func (stage *WaitStage) Options() map[string]string { return stage.options }
+func (stage *WaitStage) Title() string          { return "A Conversation" }
+func (stage *WaitStage) Man() string            { return stage.man }
+func (stage *WaitStage) Help() string           { return stage.usage }
+func (stage *WaitStage) Hints() []string        { return stage.hints }
+func (stage *WaitStage) Options() []term.Option { return stage.options }
+
+// Complete will offer listen and speak as plain words too, the player is having
+// a conversation after all
+func (stage *WaitStage) Complete(args []string, word string) []string {
+	if len(args) > 0 || strings.HasPrefix(word, "-") {
+		return nil
+	}
+	return []string{"listen", "speak"}
+}
 
 func (stage *WaitStage) Run() error {
 	if stage.in.None() {
@@ -84,16 +125,52 @@ func (stage *WaitStage) Run() error {
 	} else if stage.in.HasOpt("listen") {
 		return stage.listen()
 	} else if stage.in.HasOpt("speak") {
-		fmt.Print("I dont feel so good, I think I might puuu:")
-		return term.Errorf("{{.|bold|green}}", portMsg)
+		_, port, _ := net.SplitHostPort(stage.in.Env.ListenAddr)
+		fmt.Fprint(stage.in.Stdout, "I dont feel so good, I think I might puuu:")
+		return stage.in.Errorf("{{.|bold|success}}", util.Base64("My port is %v, call me!", port))
 	}
 	return errors.New("no idea what you are trying to do")
 }
 
 func (stage *WaitStage) listen() error {
+	srv := stage.newServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stage.solved = make(chan error, 1)
+
+	stage.release = []func(){
+		artifacts.Track(stage.in.DB, artifacts.KindProcess, "pb --listen", ID),
+		artifacts.Track(stage.in.DB, artifacts.KindPort, stage.in.Env.ListenAddr, ID),
+		artifacts.Track(stage.in.DB, artifacts.KindSignal, "SIGINFO", ID),
+		util.OnSignal(stage.in.Signals, func(sig os.Signal) {
+			if sig == sigInfo {
+				fmt.Fprintln(stage.in.Stdout, "That was clever! This is a shortcut!")
+				fmt.Fprintln(stage.in.Stdout, passwdMsg)
+			} else {
+				cancel()
+			}
+		}, sigInfo, os.Interrupt, syscall.SIGTERM),
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- srv.ListenAndServe(ctx, stage.in.Env.ListenAddr) }()
+	select {
+	case err := <-closed:
+		stage.cleanup()
+		return err
+	case change := <-stage.solved:
+		return change
+	}
+}
+
+// newServer will set up the server that the player talks to over http, ssh and
+// scp, with a shell in its own filesystem for each ssh session
+func (stage *WaitStage) newServer() *server.Server {
 	srv := server.New()
+	stage.srv = srv
+	stage.vfs = newFS()
 	srv.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("Oh that is nice, it's one way to connect with me. But sssshhh don't tell anyone")
+		fmt.Fprintln(stage.in.Stdout, "Oh that is nice, it's one way to connect with me. But sssshhh don't tell anyone")
 		w.Write([]byte("Hello friend! I am afraid I prefer different communication styles."))
 	})
 	srv.HandleSSH("> ", `============================================
@@ -102,61 +179,108 @@ func (stage *WaitStage) listen() error {
 To authenitcate run the login command.
 
 `, stage.handleSSH)
+	srv.HandleFiles(sshFiles{stage: stage}, stage.logTransfer)
+	srv.HandleClose(func(sess *server.Session) { stage.shells.Delete(sess) })
+	return srv
+}
+
+// Exit will shut down the server, stop listening for signals and release its
+// artifacts once the stage has been solved
+func (stage *WaitStage) Exit() error {
+	stage.cleanup()
+	if stage.srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return stage.srv.Shutdown(ctx)
+	}
+	return nil
+}
 
-	go util.OnSignal(func(sig os.Signal) {
-		fmt.Println("That was clever! This is a shortcut!")
-		fmt.Println(passwdMsg)
-	}, syscall.Signal(29))
+func (stage *WaitStage) cleanup() {
+	for _, release := range stage.release {
+		release()
+	}
+	stage.release = nil
+}
 
-	return srv.ListenAndServe("127.0.0.1:2023")
+// handleSSH will run the line in the player's shell, each ssh session gets its
+// own shell so that they can cd around on their own. Logging in ends the shell,
+// but a command that logged in has moved the player on so it exits with success.
+func (stage *WaitStage) handleSSH(sess *server.Session, sshTerm io.Writer, line string) error {
+	err := stage.shell(sess).Run(sshTerm, line)
+	if change := (&util.StageChange{}); sess.Command != "" && errors.As(err, &change) {
+		return nil
+	}
+	return err
 }
 
-func (stage *WaitStage) handleSSH(sshTerm io.Writer, cmd string) error {
-	cmdParts := strings.Split(strings.TrimSpace(cmd), " ")
-	switch cmdParts[0] {
-	case "exit":
-		return errors.New("Goodbye")
-	case "ls", "list", "dir", "ll", "la":
-		term.Fprint(sshTerm, fileList, fakefiles)
-	case "login":
-		if len(cmdParts) == 1 {
-			fmt.Fprintln(sshTerm, "Usage: login [password]")
-		} else if cmdParts[1] == password {
-			term.Println(`You have been {{"authenticated"|cyan}}. You are now on logged into {{"stage 3"|red}}`, nil)
-			util.SetStage(stage.in, "lisp")
-		} else if cmdParts[1] == passHex {
-			fmt.Fprintln(sshTerm, "such a curse to be so close, you could say that this password is hexed")
-		} else {
-			fmt.Fprintln(sshTerm, "Incorrect password. This incident will be reported to the authorities.")
+func (stage *WaitStage) shell(sess *server.Session) *shell.Shell {
+	sh, ok := stage.shells.Load(sess)
+	if !ok {
+		sh, _ = stage.shells.LoadOrStore(sess, stage.newShell(shellUser(sess)))
+	}
+	return sh.(*shell.Shell)
+}
+
+// shellUser is who the player is in the shell. Anyone can pick their ssh user
+// name and the server lets them in without authenticating, so they can't be
+// root or the owner of any of the files just by asking.
+func shellUser(sess *server.Session) string {
+	if sess.AuthMethod != server.AuthNone {
+		return sess.User
+	} else if sess.User == "root" {
+		return guest
+	}
+	for _, f := range fakefiles {
+		if sess.User == f.owner {
+			return guest
 		}
-	case "su", "sudo":
-		fmt.Fprintln(sshTerm, "We are confident, aren't we?")
-	case "cat":
-		if len(cmdParts) == 1 {
-			fmt.Fprintln(sshTerm, "huh?")
-		} else if len(cmdParts) >= 1 && strings.ToLower(cmdParts[1]) == "readme.md" {
-			fmt.Fprintf(sshTerm, "The password is %v\n", passHex)
-		} else if len(cmdParts) >= 1 && strings.ToLower(cmdParts[1]) == "note.txt" {
-			fmt.Fprintln(sshTerm, "not this file, the other.")
-		} else if len(cmdParts) >= 1 {
-			fmt.Fprintln(sshTerm, "you do not have permission to read that.")
-		} else {
-			fmt.Fprintln(sshTerm, "meow?")
+	}
+	return sess.User
+}
+
+func (stage *WaitStage) newShell(user string) *shell.Shell {
+	sh := shell.New(stage.vfs, user, home)
+	sh.Register("exit", func(proc *shell.Proc) error { return errors.New("Goodbye") })
+	sh.Register("login", stage.login)
+	for name, reply := range replies {
+		reply := reply
+		sh.Register(name, func(proc *shell.Proc) error {
+			fmt.Fprintln(proc.Stdout, reply)
+			return nil
+		})
+	}
+	return sh
+}
+
+func (stage *WaitStage) login(proc *shell.Proc) error {
+	if len(proc.Args) == 1 {
+		fmt.Fprintln(proc.Stdout, "Usage: login [password]")
+	} else if proc.Args[1] == password {
+		fmt.Fprintln(proc.Stdout, "Welcome.")
+		change := util.SetStage(registry.Next(ID), `You have been {{"authenticated"|success}}. You are now on logged into {{"stage 3"|danger}}`)
+		select {
+		case stage.solved <- change:
+		default:
 		}
-	case "rm":
-		fmt.Fprintln(sshTerm, "What exactly are you trying to acheive?")
-	case "help":
-		fmt.Fprintln(sshTerm, "Try looking around.")
-	case "look":
-		fmt.Fprintln(sshTerm, "This is not monkey island, this is a computer. Have you tried looking for INFO")
-	case "hello", "hi":
-		fmt.Fprintln(sshTerm, "Yes, hello again.")
-	case "2.14.98":
-		fmt.Fprintln(sshTerm, "nope that is just a random number.")
-	case "secret":
-		fmt.Fprintln(sshTerm, "not like that.")
-	default:
-		fmt.Fprintf(sshTerm, "unknown command %v", cmdParts[0])
+		return change
+	} else if proc.Args[1] == passHex {
+		fmt.Fprintln(proc.Stdout, "such a curse to be so close, you could say that this password is hexed")
+	} else {
+		fmt.Fprintln(proc.Stdout, "Incorrect password. This incident will be reported to the authorities.")
 	}
 	return nil
 }
+
+// newFS will set up the files that the player can find over ssh
+func newFS() *shell.FS {
+	vfs := shell.NewFS()
+	for _, f := range fakefiles {
+		file, _ := vfs.WriteFile(path.Join(home, f.name), []byte(f.data), f.owner, 0644)
+		file.ModTime = f.modTime
+	}
+	vfs.Mkdir("/root", "root", 0700)
+	vfs.Mkdir("/tmp", "root", 0777)
+	vfs.WriteFile("/root/secret", []byte("not like that.\n"), "root", 0600)
+	return vfs
+}
@@ -0,0 +1,118 @@
+package wait
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/tanema/pb/src/pstore"
+	"github.com/tanema/pb/src/term"
+)
+
+func count(shells *sync.Map) int {
+	n := 0
+	shells.Range(func(key, val any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// listen will serve the stage on a free port until the test is over
+func listen(t *testing.T) *WaitStage {
+	in, err := term.NewInput(term.Config{DB: pstore.NewMemory()})
+	assert.Nil(t, err)
+	stage := New(in)
+	srv := stage.newServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.ListenAndServe(ctx, "127.0.0.1:0") }()
+	for i := 0; i < 100 && srv.Addr() == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Cleanup(func() {
+		cancel()
+		assert.Nil(t, <-served)
+	})
+	return stage
+}
+
+func dial(t *testing.T, stage *WaitStage, user string) *ssh.Client {
+	client, err := ssh.Dial("tcp", stage.srv.Addr().String(), &ssh.ClientConfig{
+		User:            user,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	assert.Nil(t, err)
+	return client
+}
+
+func TestShellUser(t *testing.T) {
+	stage := listen(t)
+	for _, user := range []string{"root", "timanema"} {
+		client := dial(t, stage, user)
+		sess, err := client.NewSession()
+		assert.Nil(t, err)
+		out, _ := sess.Output("whoami")
+		assert.Equal(t, "guest\n", string(out))
+		sess, err = client.NewSession()
+		assert.Nil(t, err)
+		out, _ = sess.Output("cat /root/secret")
+		assert.Equal(t, "cat: /root/secret: permission denied\n", string(out))
+		client.Close()
+	}
+}
+
+func TestShellsDrain(t *testing.T) {
+	stage := listen(t)
+	client := dial(t, stage, "player")
+
+	open, err := client.NewSession()
+	assert.Nil(t, err)
+	stdin, err := open.StdinPipe()
+	assert.Nil(t, err)
+	assert.Nil(t, open.Shell())
+	for i := 0; i < 3; i++ {
+		sess, err := client.NewSession()
+		assert.Nil(t, err)
+		out, err := sess.Output("whoami")
+		assert.Nil(t, err)
+		assert.Equal(t, "player\n", string(out))
+	}
+	stdin.Write([]byte("pwd\r"))
+	assert.Eventually(t, func() bool { return count(&stage.shells) == 1 }, time.Second, 10*time.Millisecond)
+
+	client.Close()
+	assert.Eventually(t, func() bool { return count(&stage.shells) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestLoginExec(t *testing.T) {
+	stage := listen(t)
+	client := dial(t, stage, "player")
+	defer client.Close()
+
+	sess, err := client.NewSession()
+	assert.Nil(t, err)
+	out, err := sess.Output("login hackerman")
+	assert.Nil(t, err)
+	assert.Equal(t, "Welcome.\n", string(out))
+
+	sess, err = client.NewSession()
+	assert.Nil(t, err)
+	exitErr := &ssh.ExitError{}
+	assert.ErrorAs(t, sess.Run("exit"), &exitErr)
+	assert.Equal(t, 1, exitErr.ExitStatus())
+}
+
+func TestSpeakPort(t *testing.T) {
+	in, err := term.NewInput(term.Config{
+		Args: []string{"--speak"},
+		DB:   pstore.NewMemory(),
+		Env:  map[string]string{"PB_LISTEN_ADDR": "127.0.0.1:4242"},
+	})
+	assert.Nil(t, err)
+	assert.EqualError(t, New(in).Run(), "TXkgcG9ydCBpcyA0MjQyLCBjYWxsIG1lIQ==")
+}
@@ -17,33 +17,49 @@ const (
 	clearLastLine = "\033[G\033[1A\033[K"
 )
 
-var spinGlyphs = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
-
-var funcMap = template.FuncMap{
-	"bright":    ansiStyler("3", "9"),
-	"Bright":    ansiStyler("4", "10"),
-	"bold":      ansiStyler("1"),
-	"faint":     ansiStyler("2"),
-	"italic":    ansiStyler("3"),
-	"underline": ansiStyler("4"),
-	"invert":    ansiStyler("7"),
-	"black":     ansiStyler("30"),
-	"red":       ansiStyler("31"),
-	"green":     ansiStyler("32"),
-	"yellow":    ansiStyler("33"),
-	"blue":      ansiStyler("34"),
-	"magenta":   ansiStyler("35"),
-	"cyan":      ansiStyler("36"),
-	"white":     ansiStyler("37"),
-	"Black":     ansiStyler("40"),
-	"Red":       ansiStyler("41"),
-	"Green":     ansiStyler("42"),
-	"Yellow":    ansiStyler("43"),
-	"Blue":      ansiStyler("44"),
-	"Magenta":   ansiStyler("45"),
-	"Cyan":      ansiStyler("46"),
-	"White":     ansiStyler("47"),
-	"spin":      spin,
+var (
+	spinGlyphs = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+	ansiStart  = regexp.MustCompile("^" + ansiPat)
+	ansiAll    = regexp.MustCompile(ansiPat)
+)
+
+// funcMap is what the package funcs render with, the default theme in basic
+// colors. An Input renders with its own funcs for the player's terminal.
+var funcMap = newFuncMap(Color16, Themes["default"])
+
+// newFuncMap will create the template funcs that style text for the profile,
+// with the semantic names styled by the theme
+func newFuncMap(p ColorProfile, theme Theme) template.FuncMap {
+	funcs := template.FuncMap{
+		"bright":    ansiStyler(p, "3", "9"),
+		"Bright":    ansiStyler(p, "4", "10"),
+		"bold":      ansiStyler(p, "1"),
+		"faint":     ansiStyler(p, "2"),
+		"italic":    ansiStyler(p, "3"),
+		"underline": ansiStyler(p, "4"),
+		"invert":    ansiStyler(p, "7"),
+		"black":     ansiStyler(p, "30"),
+		"red":       ansiStyler(p, "31"),
+		"green":     ansiStyler(p, "32"),
+		"yellow":    ansiStyler(p, "33"),
+		"blue":      ansiStyler(p, "34"),
+		"magenta":   ansiStyler(p, "35"),
+		"cyan":      ansiStyler(p, "36"),
+		"white":     ansiStyler(p, "37"),
+		"Black":     ansiStyler(p, "40"),
+		"Red":       ansiStyler(p, "41"),
+		"Green":     ansiStyler(p, "42"),
+		"Yellow":    ansiStyler(p, "43"),
+		"Blue":      ansiStyler(p, "44"),
+		"Magenta":   ansiStyler(p, "45"),
+		"Cyan":      ansiStyler(p, "46"),
+		"White":     ansiStyler(p, "47"),
+		"spin":      spin,
+	}
+	for _, name := range semanticNames {
+		funcs[name] = themeStyler(p, theme[name])
+	}
+	return funcs
 }
 
 var spinIndex int
@@ -95,8 +111,11 @@ func (ansi ansiStr) String() string {
 	return fmt.Sprintf("\033[%vm%v\033[m", strings.Join(ansi.vals, ";"), ansi.str)
 }
 
-func ansiStyler(attrs ...string) func(interface{}) string {
+func ansiStyler(p ColorProfile, attrs ...string) func(interface{}) string {
 	return func(v interface{}) string {
+		if p == NoColor {
+			return fmt.Sprintf("%v", v)
+		}
 		ansistr := parseAnsiString(fmt.Sprintf("%v", v))
 		if len(attrs) == 1 {
 			ansistr.add(attrs[0])
@@ -107,24 +126,104 @@ func ansiStyler(attrs ...string) func(interface{}) string {
 	}
 }
 
+// StripANSI will remove all ANSI escape codes from the string
+func StripANSI(src string) string {
+	return string(removeANSI([]byte(src)))
+}
+
 func removeANSI(src []byte) []byte {
-	regx := regexp.MustCompile(ansiPat)
-	return regx.ReplaceAll(src, []byte(""))
+	return ansiAll.ReplaceAll(src, []byte(""))
+}
+
+// wrapper wraps text to a width as it is written. Words are kept whole unless
+// they are too long for a line on their own, and styles that are active when a
+// line is wrapped are reset at its end and opened again on the next line.
+type wrapper struct {
+	out, word, space      strings.Builder
+	max, col              int
+	wordWidth, spaceWidth int
+	sgr                   []string
+	joined                bool
 }
 
+// wrapANSI will wrap the string so that no line is wider than width-1 columns,
+// leaving the last column free so the terminal does not wrap it again.
 func wrapANSI(src string, width int) string {
-	str := []byte(src)
-	var output, currentLine []byte
-	for _, s := range str {
-		currentLine = append(currentLine, s)
-		runes := utf8.RuneCount(removeANSI(currentLine))
-		if s == '\n' || runes >= width-1 {
-			if s != '\n' {
-				currentLine = append(currentLine, '\n')
+	w := &wrapper{max: width - 1}
+	if w.max < 1 {
+		w.max = 1
+	}
+	for i := 0; i < len(src); {
+		if src[i] == '\033' {
+			if loc := ansiStart.FindStringIndex(src[i:]); loc != nil {
+				w.word.WriteString(src[i : i+loc[1]])
+				i += loc[1]
+				continue
 			}
-			output = append(output, currentLine...)
-			currentLine = []byte{}
 		}
+		r, size := utf8.DecodeRuneInString(src[i:])
+		w.writeRune(r, src[i:i+size])
+		i += size
+	}
+	w.flush()
+	return w.out.String()
+}
+
+func (w *wrapper) writeRune(r rune, raw string) {
+	width := runeWidth(r)
+	if w.joined {
+		width = 0
+	}
+	w.joined = r == zeroWidthJoiner
+	if r == '\n' {
+		w.flush()
+		w.out.WriteByte('\n')
+		w.col = 0
+		return
+	} else if r == ' ' {
+		w.flush()
+		w.space.WriteString(raw)
+		w.spaceWidth += width
+		return
+	} else if w.col+w.spaceWidth+w.wordWidth+width > w.max {
+		if w.col == 0 || w.wordWidth+width > w.max {
+			w.flush()
+		}
+		if w.col > 0 {
+			w.newline()
+		}
+	}
+	w.word.WriteString(raw)
+	w.wordWidth += width
+}
+
+// flush will add the pending spaces and word to the line
+func (w *wrapper) flush() {
+	word := w.word.String()
+	w.out.WriteString(w.space.String())
+	w.out.WriteString(word)
+	for _, seq := range ansiAll.FindAllString(word, -1) {
+		if !strings.HasSuffix(seq, "m") {
+			continue
+		} else if params := seq[2 : len(seq)-1]; params == "" || params == "0" {
+			w.sgr = nil
+		} else {
+			w.sgr = append(w.sgr, seq)
+		}
+	}
+	w.col += w.spaceWidth + w.wordWidth
+	w.space.Reset()
+	w.word.Reset()
+	w.spaceWidth, w.wordWidth = 0, 0
+}
+
+// newline will wrap the line, dropping any spaces that were pending
+func (w *wrapper) newline() {
+	if len(w.sgr) > 0 {
+		w.out.WriteString("\033[m")
 	}
-	return string(append(output, currentLine...))
+	w.out.WriteByte('\n')
+	w.out.WriteString(strings.Join(w.sgr, ""))
+	w.space.Reset()
+	w.col, w.spaceWidth = 0, 0
 }
@@ -1,7 +1,9 @@
 package term
 
 import (
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -40,13 +42,15 @@ func TestAnsiStringReplace(t *testing.T) {
 }
 
 func TestAnsiStyler(t *testing.T) {
-	replace := ansiStyler("3", "9")
+	replace := ansiStyler(Color16, "3", "9")
 	actual := replace("\033[31;4mHello World\033[m")
 	assert.Equal(t, "\033[91;4mHello World\033[m", actual)
 
-	add := ansiStyler("39")
+	add := ansiStyler(Color16, "39")
 	actual = add("\033[31;4mHello World\033[m")
 	assert.Equal(t, "\033[31;4;39mHello World\033[m", actual)
+
+	assert.Equal(t, "Hello World", ansiStyler(NoColor, "39")("Hello World"))
 }
 
 func TestRemoveANSI(t *testing.T) {
@@ -58,5 +62,63 @@ func TestRemoveANSI(t *testing.T) {
 func TestWrapAnsi(t *testing.T) {
 	str := "\033[31;4mHello \033[1mWorld\033[m"
 	out := wrapANSI(str, 10)
-	assert.Equal(t, "\033[31;4mHello \033[1mWor\nld\033[m", out)
+	assert.Equal(t, "\033[31;4mHello\033[m\n\033[31;4m\033[1mWorld\033[m", out)
+
+	cases := []struct {
+		in, out string
+		width   int
+	}{
+		{"the quick brown fox", "the quick\nbrown fox", 11},
+		{"a\nb c", "a\nb c", 11},
+		{"abcdefghijkl", "abcde\nfghij\nkl", 6},
+		{"ab abcdefghijkl", "ab\nabcde\nfghij\nkl", 6},
+		{"日本語のテキスト", "日本語の\nテキスト", 10},
+		{"cafe\u0301 cafe\u0301", "cafe\u0301\ncafe\u0301", 8},
+		{"hi 👩\u200d💻 ok", "hi 👩\u200d💻\nok", 7},
+		{"日本", "日\n本", 1},
+		{"\033[36mone two\033[m three", "\033[36mone\033[m\n\033[36mtwo\033[m\nthree", 6},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.out, wrapANSI(tc.in, tc.width), tc.in)
+	}
+}
+
+func TestStringWidth(t *testing.T) {
+	assert.Equal(t, 5, stringWidth("\033[1mhello\033[m"))
+	assert.Equal(t, 6, stringWidth("日本語"))
+	assert.Equal(t, 4, stringWidth("cafe\u0301"))
+	assert.Equal(t, 2, stringWidth("👩\u200d💻"))
+	assert.Equal(t, 2, stringWidth("👍"))
+}
+
+// legacyWrapANSI is how wrapANSI used to work, kept to benchmark against
+func legacyWrapANSI(src string, width int) string {
+	str := []byte(src)
+	var output, currentLine []byte
+	for _, s := range str {
+		currentLine = append(currentLine, s)
+		runes := utf8.RuneCount(removeANSI(currentLine))
+		if s == '\n' || runes >= width-1 {
+			if s != '\n' {
+				currentLine = append(currentLine, '\n')
+			}
+			output = append(output, currentLine...)
+			currentLine = []byte{}
+		}
+	}
+	return string(append(output, currentLine...))
+}
+
+var benchText = strings.Repeat("\033[1mThe quick brown fox\033[m jumps over the 怠惰な dog. ", 50)
+
+func BenchmarkWrapANSI(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		wrapANSI(benchText, 80)
+	}
+}
+
+func BenchmarkLegacyWrapANSI(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		legacyWrapANSI(benchText, 80)
+	}
 }
@@ -4,54 +4,244 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
-	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/mattn/go-isatty"
 	"github.com/sethvargo/go-envconfig"
+	"github.com/tanema/pb/src/crypto"
 	"github.com/tanema/pb/src/pstore"
 )
 
 // Input captures terminal input
 type Input struct {
-	IsTTY   bool
-	HasPipe bool
-	Flags   map[string]any
-	Args    []string
-	Stdin   []byte
-	Hints   int
-	DB      *pstore.DB
-	Env     struct {
-		User   string `env:"USER,default=Timmy"`
-		Home   string `env:"HOME"`
-		Shell  string `env:"SHELL"`
-		Editor string `env:"EDITOR"`
-		Lang   string `env:"LANG"`
+	Name     string
+	IsTTY    bool
+	HasPipe  bool
+	Flags    map[string]any
+	Args     []string
+	Opts     *Opts
+	rawArgs  []string
+	piped    *bufio.Reader
+	terminal io.Reader
+	profile  ColorProfile
+	funcs    template.FuncMap
+	Stdin    io.Reader
+	Stdout   io.Writer
+	Stderr   io.Writer
+	Signals  <-chan os.Signal
+	Hints    int
+	DB       *pstore.DB
+	Env      struct {
+		User         string        `env:"USER,default=Timmy"`
+		Home         string        `env:"HOME"`
+		Shell        string        `env:"SHELL"`
+		Editor       string        `env:"EDITOR"`
+		Lang         string        `env:"LANG"`
+		ManDir       string        `env:"PB_MAN_DIR,default=/usr/local/share/man/man1"`
+		ListenAddr   string        `env:"PB_LISTEN_ADDR,default=127.0.0.1:2023"`
+		StdinMax     int64         `env:"PB_STDIN_MAX,default=16777216"`
+		StdinTimeout time.Duration `env:"PB_STDIN_TIMEOUT"`
+		ManPath      string        `env:"MANPATH"`
+		DataHome     string        `env:"XDG_DATA_HOME"`
+		NoColor      string        `env:"NO_COLOR"`
+		Term         string        `env:"TERM"`
+		ColorTerm    string        `env:"COLORTERM"`
+		Theme        string        `env:"PB_THEME,default=default"`
+		Store        struct {
+			Kind       string `env:"PB_STORE,default=file"`
+			Path       string `env:"PB_STORE_PATH"`
+			ConfigHome string `env:"XDG_CONFIG_HOME"`
+		}
 	}
 }
 
+// Config describes everything an Input is built from so that an Input can be
+// created without the running process. A nil Stdin means that nothing was
+// piped in, Terminal is where keys are read from when nothing was piped in and
+// a nil Terminal means there is no one to answer. Signals are what a stage
+// handles instead of the signals sent to the process. Nil writers will discard
+// output and if no DB is provided one will be opened with the store selected by
+// the environment. Output is only colored
+// when both IsTTY and ErrTTY are set, as in when stdout and stderr are terminals.
+type Config struct {
+	Name     string
+	Args     []string
+	Stdin    io.Reader
+	Terminal io.Reader
+	Signals  <-chan os.Signal
+	Env      map[string]string
+	IsTTY    bool
+	ErrTTY   bool
+	Stdout   io.Writer
+	Stderr   io.Writer
+	DB       *pstore.DB
+}
+
 // ParseInput will parse flags and positional arguments as well as read from
 // stdin to fully collect all inputs
 func ParseInput() (*Input, error) {
-	stat, _ := os.Stdin.Stat()
+	cfg := Config{
+		Name:     os.Args[0],
+		Args:     os.Args[1:],
+		Terminal: os.Stdin,
+		IsTTY:    isatty.IsTerminal(os.Stdout.Fd()),
+		ErrTTY:   isatty.IsTerminal(os.Stderr.Fd()),
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+	}
+	if stat, _ := os.Stdin.Stat(); (stat.Mode() & os.ModeCharDevice) == 0 {
+		cfg.Stdin = os.Stdin
+	}
+	return NewInput(cfg)
+}
+
+// NewInput will create an Input from the config, parsing the flags and
+// positional arguments. Stdin is not read until a stage asks for it.
+func NewInput(cfg Config) (*Input, error) {
 	in := &Input{
-		IsTTY:   isatty.IsTerminal(os.Stdout.Fd()),
-		HasPipe: (stat.Mode() & os.ModeCharDevice) == 0,
-		Flags:   map[string]any{},
-	}
-	in.readPipe()
-	in.parseArgs()
-	envconfig.Process(context.Background(), &in.Env)
-	db, err := pstore.New("pb", ".data")
+		Name:     cfg.Name,
+		IsTTY:    cfg.IsTTY,
+		HasPipe:  cfg.Stdin != nil,
+		Flags:    map[string]any{},
+		Stdout:   cfg.Stdout,
+		Stderr:   cfg.Stderr,
+		Signals:  cfg.Signals,
+		terminal: cfg.Terminal,
+		profile:  Color16,
+		funcs:    funcMap,
+	}
+	if in.Stdout == nil {
+		in.Stdout = io.Discard
+	}
+	if in.Stderr == nil {
+		in.Stderr = io.Discard
+	}
+	if in.terminal == nil {
+		in.terminal = bytes.NewReader(nil)
+	}
+	global, err := ParseOpts([]Option{{Name: "slot", Type: OptString}}, cfg.Args)
+	if err != nil {
+		return in, err
+	}
+	in.parseArgs(withoutOpt(cfg.Args, "slot"))
+	in.Opts = global
+	lookuper := envconfig.OsLookuper()
+	if cfg.Env != nil {
+		lookuper = envconfig.MapLookuper(cfg.Env)
+	}
+	if err := envconfig.ProcessWith(context.Background(), &in.Env, lookuper); err != nil {
+		return in, err
+	}
+	theme, err := findTheme(in.Env.Theme)
 	if err != nil {
-		return nil, err
+		return in, err
+	}
+	in.profile = DetectColor(cfg.IsTTY && cfg.ErrTTY, in.Env.NoColor, in.Env.Term, in.Env.ColorTerm)
+	in.funcs = newFuncMap(in.profile, theme)
+	in.Stdin = bytes.NewReader(nil)
+	if in.HasPipe {
+		in.Stdin = newStdin(cfg.Stdin, in.Env.StdinMax, in.Env.StdinTimeout)
+	}
+	in.DB = cfg.DB
+	if in.DB == nil {
+		key, err := crypto.DeriveKey(crypto.MachineSecret(in.Env.Home))
+		if err != nil {
+			return in, err
+		}
+		store, err := pstore.Select(pstore.Options{
+			Kind:       in.Env.Store.Kind,
+			Path:       in.Env.Store.Path,
+			Home:       in.Env.Home,
+			ConfigHome: in.Env.Store.ConfigHome,
+			AppName:    "pb",
+			Filename:   ".data",
+			Slot:       global.String("slot"),
+			Sealer:     key,
+		})
+		if err != nil {
+			return in, err
+		}
+		if in.DB, err = pstore.New(store); errors.Is(err, pstore.ErrTampered) && in.HasFlags("reset") {
+			if err := store.Reset(); err != nil {
+				return in, err
+			} else if in.DB, err = pstore.New(store); err != nil {
+				return in, err
+			}
+		} else if err != nil {
+			return in, err
+		}
 	}
-	in.DB = db
-	in.Hints, _ = strconv.Atoi(db.Get("hints"))
+	in.Hints = in.State().Int("hints")
 	return in, nil
 }
 
+// State will return the namespace in the DB that stage progress is kept in
+func (in *Input) State() *pstore.Namespace {
+	return in.DB.Namespace(pstore.StageNS)
+}
+
+// Println will render the template with the data to stderr
+func (in *Input) Println(tmpl string, data any) error {
+	return in.Fprint(in.Stderr, tmpl+"\n", data)
+}
+
+// Fprint will render the template with the data to the writer, styled with the
+// player's theme and as much color as their terminal supports
+func (in *Input) Fprint(out io.Writer, tmpl string, data any) error {
+	return fprint(out, in.funcs, tmpl, data)
+}
+
+// Sprintf will render the template with the data styled for the player
+func (in *Input) Sprintf(tmpl string, data any) string {
+	buf := bytes.NewBuffer(nil)
+	in.Fprint(buf, tmpl, data)
+	return buf.String()
+}
+
+// Errorf will render the template with the data as an error styled for the
+// player
+func (in *Input) Errorf(tmpl string, data any) error {
+	return errors.New(in.Sprintf(tmpl, data))
+}
+
+// Confirm will ask the player a yes or no question, reading the answer from what
+// was piped in or from the terminal
+func (in *Input) Confirm(question string) bool {
+	fmt.Fprint(in.Stderr, question+" [y/N] ")
+	answer, _ := bufio.NewReader(in.keys()).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// keys is where answers to questions are read from, what was piped in or the
+// terminal. What was piped in is buffered once so that nothing is lost between
+// questions.
+func (in *Input) keys() io.Reader {
+	if !in.HasPipe {
+		return in.terminal
+	} else if in.piped == nil {
+		in.piped = bufio.NewReader(in.Stdin)
+	}
+	return in.piped
+}
+
+// ParseOpts will parse the arguments against the options into Opts. Flags and
+// Args are still parsed permissively for puzzles that will match anything.
+func (in *Input) ParseOpts(options []Option) error {
+	opts, err := ParseOpts(options, in.rawArgs)
+	if err != nil {
+		return err
+	}
+	in.Opts = opts
+	return nil
+}
+
 // None will return true if the cli was passed no arguments
 func (in *Input) None() bool {
 	return len(in.Flags) == 0 && len(in.Args) == 0 && !in.HasPipe
@@ -84,26 +274,41 @@ func (in *Input) HasArgs(args ...string) bool {
 	return false
 }
 
-func (in *Input) readPipe() {
-	if !in.HasPipe {
-		return
-	}
-	var buf bytes.Buffer
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Split(bufio.ScanBytes)
-	for scanner.Scan() {
-		buf.Write(scanner.Bytes())
+// ReadStdin will read everything that was piped in, for stages that need the
+// whole payload. It fails if more than PB_STDIN_MAX bytes are piped in or it is
+// still waiting after PB_STDIN_TIMEOUT.
+func (in *Input) ReadStdin() ([]byte, error) {
+	return io.ReadAll(in.Stdin)
+}
+
+// withoutOpt will take an option that pb handles for every stage, and its value,
+// out of the args so that stages never see it
+func withoutOpt(args []string, name string) []string {
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			return append(rest, args[i:]...)
+		} else if args[i] == "--"+name {
+			i++
+		} else if !strings.HasPrefix(args[i], "--"+name+"=") {
+			rest = append(rest, args[i])
+		}
 	}
-	in.Stdin = buf.Bytes()
+	return rest
 }
 
-func (in *Input) parseArgs() {
-	args := os.Args[1:]
-	for _, arg := range args {
-		if strings.HasPrefix(arg, "--") {
+func (in *Input) parseArgs(args []string) {
+	in.rawArgs = args
+	for i, arg := range args {
+		if arg == "--" {
+			for _, arg := range args[i+1:] {
+				in.Args = append(in.Args, strings.ToLower(arg))
+			}
+			return
+		} else if strings.HasPrefix(arg, "--") {
 			arg = strings.TrimPrefix(arg, "--")
 			if strings.Contains(arg, "=") {
-				parts := strings.Split(arg, "=")
+				parts := strings.SplitN(arg, "=", 2)
 				in.Flags[strings.ToLower(parts[0])] = parts[1]
 			} else {
 				in.Flags[strings.ToLower(arg)] = true
@@ -111,7 +316,7 @@ func (in *Input) parseArgs() {
 		} else if strings.HasPrefix(arg, "-") {
 			arg = strings.TrimPrefix(arg, "-")
 			if strings.Contains(arg, "=") {
-				parts := strings.Split(arg, "=")
+				parts := strings.SplitN(arg, "=", 2)
 				in.Flags[strings.ToLower(parts[0])] = parts[1]
 			} else {
 				for _, v := range strings.Split(arg, "") {
@@ -0,0 +1,133 @@
+//go:build !windows
+// +build !windows
+
+package term
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+type (
+	// KeyCode is a key that was pressed that is not just a character
+	KeyCode int
+	// Key is a single key press, Rune is set when Code is KeyRune
+	Key struct {
+		Code KeyCode
+		Rune rune
+	}
+	// KeyReader reads key presses, including arrow keys, from a terminal in raw
+	// mode or from anything piped in
+	KeyReader struct {
+		r *bufio.Reader
+	}
+	// crlfWriter returns the carriage as well as adding a new line, which a
+	// terminal in raw mode no longer does on its own
+	crlfWriter struct {
+		w io.Writer
+	}
+)
+
+const (
+	// KeyRune is a printable character
+	KeyRune KeyCode = iota
+	// KeyEnter is enter or return
+	KeyEnter
+	// KeyBackspace is backspace or delete
+	KeyBackspace
+	// KeyTab is tab
+	KeyTab
+	// KeyEscape is escape on its own
+	KeyEscape
+	// KeyUp is the up arrow
+	KeyUp
+	// KeyDown is the down arrow
+	KeyDown
+	// KeyRight is the right arrow
+	KeyRight
+	// KeyLeft is the left arrow
+	KeyLeft
+	// KeyInterrupt is ctrl-c
+	KeyInterrupt
+)
+
+// ErrInterrupt is returned by widgets when the player presses ctrl-c
+var ErrInterrupt = errors.New("interrupted")
+
+// NewKeyReader will create a KeyReader that reads from r
+func NewKeyReader(r io.Reader) *KeyReader {
+	return &KeyReader{r: bufio.NewReader(r)}
+}
+
+// ReadKey will read the next key press. Ctrl-d is returned as io.EOF.
+func (kr *KeyReader) ReadKey() (Key, error) {
+	r, _, err := kr.r.ReadRune()
+	if err != nil {
+		return Key{}, err
+	}
+	switch r {
+	case '\r', '\n':
+		return Key{Code: KeyEnter}, nil
+	case 127, '\b':
+		return Key{Code: KeyBackspace}, nil
+	case '\t':
+		return Key{Code: KeyTab}, nil
+	case 3:
+		return Key{Code: KeyInterrupt}, nil
+	case 4:
+		return Key{}, io.EOF
+	case '\033':
+		return kr.readEscape()
+	}
+	return Key{Code: KeyRune, Rune: r}, nil
+}
+
+// readEscape will read the rest of an arrow key sequence. An escape that is not
+// followed by anything that has already arrived is the escape key itself.
+func (kr *KeyReader) readEscape() (Key, error) {
+	if kr.r.Buffered() < 2 {
+		return Key{Code: KeyEscape}, nil
+	} else if next, _ := kr.r.Peek(2); next[0] != '[' && next[0] != 'O' {
+		return Key{Code: KeyEscape}, nil
+	}
+	seq := make([]byte, 2)
+	io.ReadFull(kr.r, seq)
+	switch seq[1] {
+	case 'A':
+		return Key{Code: KeyUp}, nil
+	case 'B':
+		return Key{Code: KeyDown}, nil
+	case 'C':
+		return Key{Code: KeyRight}, nil
+	case 'D':
+		return Key{Code: KeyLeft}, nil
+	}
+	return Key{Code: KeyEscape}, nil
+}
+
+// rawMode will put the reader into raw mode if it is a terminal so that keys
+// are read as they are pressed. The writer that is returned should be used for
+// output until the returned restore func is called.
+func rawMode(r io.Reader, w io.Writer) (io.Writer, func(), error) {
+	file, ok := r.(*os.File)
+	if !ok || !term.IsTerminal(int(file.Fd())) {
+		return w, func() {}, nil
+	}
+	state, err := term.MakeRaw(int(file.Fd()))
+	if err != nil {
+		return w, func() {}, err
+	}
+	return &crlfWriter{w: w}, func() { term.Restore(int(file.Fd()), state) }, nil
+}
+
+func (cw *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(cw.w, strings.ReplaceAll(string(p), "\n", "\r\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,196 @@
+package term
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// OptionType is the type of value that an option takes
+	OptionType string
+	// Option declares a flag so that it can be parsed with the right type and
+	// shown in the usage. Names are matched ignoring case unless KeepCase is set,
+	// single letter names and aliases are used with a single dash. An Optional
+	// value can be left off and is only taken with --name=value.
+	Option struct {
+		Name     string     `yaml:"name" json:"name"`
+		Aliases  []string   `yaml:"aliases" json:"aliases"`
+		Type     OptionType `yaml:"type" json:"type"`
+		Usage    string     `yaml:"usage" json:"usage"`
+		KeepCase bool       `yaml:"keepCase" json:"keepCase"`
+		Optional bool       `yaml:"optional" json:"optional"`
+	}
+	// Opts are the flags and positional arguments parsed against options. Flags
+	// are kept under the name of their option, arguments keep their case.
+	Opts struct {
+		values map[string][]string
+		Args   []string
+	}
+)
+
+const (
+	// OptBool is a flag that is either set or not, it is the default type
+	OptBool OptionType = "bool"
+	// OptString takes a value
+	OptString OptionType = "string"
+	// OptInt takes a value that has to be a number
+	OptInt OptionType = "int"
+	// OptStrings takes a value and can be repeated to collect a list
+	OptStrings OptionType = "strings"
+)
+
+// Flag will return how the option is written on the command line with its
+// aliases, like --help -h
+func (opt Option) Flag() string {
+	flags := []string{}
+	for _, name := range append([]string{opt.Name}, opt.Aliases...) {
+		if len(name) == 1 {
+			flags = append(flags, "-"+name)
+		} else {
+			flags = append(flags, "--"+name)
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+func (opt Option) takesValue() bool {
+	return opt.Type != "" && opt.Type != OptBool
+}
+
+func (opt Option) matches(name string) bool {
+	for _, candidate := range append([]string{opt.Name}, opt.Aliases...) {
+		if candidate == name || (!opt.KeepCase && strings.EqualFold(candidate, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseOpts will parse the args against the options. It supports --name=value,
+// --name value, -n value, grouped single letter flags like -abc, repeated flags
+// and -- to end the flags. Flags that are not declared are kept as bool flags
+// so that puzzles can still match anything, but declared options will return
+// an error if they are missing their value or their value is the wrong type.
+func ParseOpts(options []Option, args []string) (*Opts, error) {
+	opts := &Opts{values: map[string][]string{}, Args: []string{}}
+	for i := 0; i < len(args); i++ {
+		var err error
+		arg := args[i]
+		if arg == "--" {
+			opts.Args = append(opts.Args, args[i+1:]...)
+			break
+		} else if !strings.HasPrefix(arg, "-") || arg == "-" {
+			opts.Args = append(opts.Args, arg)
+		} else if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			i, err = opts.parse(options, name, value, hasValue, args, i)
+		} else {
+			group := arg[1:]
+			for j := 0; j < len(group) && err == nil; j++ {
+				name, rest := group[j:j+1], group[j+1:]
+				if opt, ok := findOption(options, name); ok && opt.takesValue() && rest != "" {
+					_, err = opts.parse(options, name, strings.TrimPrefix(rest, "="), true, nil, i)
+					break
+				} else if strings.HasPrefix(rest, "=") {
+					_, err = opts.parse(options, name, rest[1:], true, nil, i)
+					break
+				} else if rest == "" {
+					i, err = opts.parse(options, name, "", false, args, i)
+				} else {
+					_, err = opts.parse(options, name, "", false, nil, i)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// parse will add the flag to the opts, if the flag needs a value and does not
+// have one it will take the next arg and return the index of the arg it used.
+func (opts *Opts) parse(options []Option, name, value string, hasValue bool, args []string, i int) (int, error) {
+	opt, declared := findOption(options, name)
+	if !declared {
+		if len(name) > 1 {
+			name = strings.ToLower(name)
+		}
+		opts.add(name, value)
+		return i, nil
+	} else if !opt.takesValue() {
+		return i, opts.setBool(opt, value, hasValue)
+	} else if !hasValue && opt.Optional {
+		opts.add(opt.Name, "")
+		return i, nil
+	} else if !hasValue && i+1 < len(args) {
+		i++
+		value, hasValue = args[i], true
+	}
+	if !hasValue {
+		return i, fmt.Errorf("%v needs a value", opt.Flag())
+	} else if _, err := strconv.Atoi(value); opt.Type == OptInt && err != nil {
+		return i, fmt.Errorf("%v expects a number but got %q", opt.Flag(), value)
+	}
+	opts.add(opt.Name, value)
+	return i, nil
+}
+
+func findOption(options []Option, name string) (Option, bool) {
+	for _, opt := range options {
+		if opt.matches(name) {
+			return opt, true
+		}
+	}
+	return Option{}, false
+}
+
+func (opts *Opts) add(name, value string) {
+	opts.values[name] = append(opts.values[name], value)
+}
+
+func (opts *Opts) setBool(opt Option, value string, hasValue bool) error {
+	if !hasValue {
+		opts.add(opt.Name, "true")
+		return nil
+	}
+	val, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%v expects true or false but got %q", opt.Flag(), value)
+	} else if val {
+		opts.add(opt.Name, "true")
+	}
+	return nil
+}
+
+// Has will return true if the flag was passed
+func (opts *Opts) Has(name string) bool {
+	_, ok := opts.values[name]
+	return ok
+}
+
+// Bool will return true if the flag was passed
+func (opts *Opts) Bool(name string) bool {
+	return opts.Has(name)
+}
+
+// String will return the value of the flag, if it was passed more than once the
+// last value is used
+func (opts *Opts) String(name string) string {
+	if vals := opts.values[name]; len(vals) > 0 {
+		return vals[len(vals)-1]
+	}
+	return ""
+}
+
+// Int will return the value of the flag as a number, or 0 if it was not passed
+func (opts *Opts) Int(name string) int {
+	val, _ := strconv.Atoi(opts.String(name))
+	return val
+}
+
+// Strings will return every value that the flag was passed
+func (opts *Opts) Strings(name string) []string {
+	return append([]string{}, opts.values[name]...)
+}
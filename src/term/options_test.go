@@ -0,0 +1,75 @@
+package term
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testOptions = []Option{
+	{Name: "help", Aliases: []string{"h"}},
+	{Name: "import", Type: OptString},
+	{Name: "color", Type: OptString, Optional: true},
+	{Name: "count", Aliases: []string{"c"}, Type: OptInt},
+	{Name: "tag", Aliases: []string{"t"}, Type: OptStrings},
+	{Name: "V", KeepCase: true},
+}
+
+func TestParseOpts(t *testing.T) {
+	opts, err := ParseOpts(testOptions, []string{"-h", "--IMPORT=a=b=c", "--count", "3", "Lisp.scm", "-t", "one", "--tag=two", "--", "--not-a-flag"})
+	assert.Nil(t, err)
+	assert.True(t, opts.Bool("help"))
+	assert.Equal(t, "a=b=c", opts.String("import"))
+	assert.Equal(t, 3, opts.Int("count"))
+	assert.Equal(t, []string{"one", "two"}, opts.Strings("tag"))
+	assert.Equal(t, []string{"Lisp.scm", "--not-a-flag"}, opts.Args)
+	assert.False(t, opts.Has("not-a-flag"))
+}
+
+func TestParseOptsOptional(t *testing.T) {
+	opts, err := ParseOpts(testOptions, []string{"--color", "arg"})
+	assert.Nil(t, err)
+	assert.True(t, opts.Has("color"))
+	assert.Equal(t, "", opts.String("color"))
+	assert.Equal(t, []string{"arg"}, opts.Args)
+
+	opts, err = ParseOpts(testOptions, []string{"--color=always"})
+	assert.Nil(t, err)
+	assert.Equal(t, "always", opts.String("color"))
+}
+
+func TestParseOptsShortGroups(t *testing.T) {
+	opts, err := ParseOpts(testOptions, []string{"-hc5", "-xy", "-t=one", "-tTwo"})
+	assert.Nil(t, err)
+	assert.True(t, opts.Bool("help"))
+	assert.Equal(t, 5, opts.Int("count"))
+	assert.True(t, opts.Has("x"))
+	assert.True(t, opts.Has("y"))
+	assert.Equal(t, []string{"one", "Two"}, opts.Strings("tag"))
+}
+
+func TestParseOptsPermissive(t *testing.T) {
+	opts, err := ParseOpts(testOptions, []string{"--Candy", "--swarm=now", "-v"})
+	assert.Nil(t, err)
+	assert.True(t, opts.Has("candy"))
+	assert.Equal(t, "now", opts.String("swarm"))
+	assert.True(t, opts.Has("v"))
+	assert.False(t, opts.Has("V"))
+}
+
+func TestParseOptsErrors(t *testing.T) {
+	_, err := ParseOpts(testOptions, []string{"--import"})
+	assert.EqualError(t, err, "--import needs a value")
+	_, err = ParseOpts(testOptions, []string{"-c", "many"})
+	assert.EqualError(t, err, `--count -c expects a number but got "many"`)
+	_, err = ParseOpts(testOptions, []string{"--help=maybe"})
+	assert.EqualError(t, err, `--help -h expects true or false but got "maybe"`)
+	opts, err := ParseOpts(testOptions, []string{"--help=false"})
+	assert.Nil(t, err)
+	assert.False(t, opts.Bool("help"))
+}
+
+func TestOptionFlag(t *testing.T) {
+	assert.Equal(t, "--help -h", testOptions[0].Flag())
+	assert.Equal(t, "-V", testOptions[5].Flag())
+}
@@ -0,0 +1,61 @@
+package term
+
+import "strings"
+
+const (
+	roffIndent     = "       "
+	roffDescIndent = "           "
+)
+
+// RenderRoff will render a manpage written with mdoc macros as styled text, so
+// that it can be read where man is not installed. Only the macros that pb uses
+// are supported and any other requests are dropped.
+func RenderRoff(src string) string {
+	return renderRoff(src, Color16)
+}
+
+// RenderRoff will render a manpage as styled text for the player's terminal
+func (in *Input) RenderRoff(src string) string {
+	return renderRoff(src, in.profile)
+}
+
+func renderRoff(src string, p ColorProfile) string {
+	roffBold, roffUnderline := ansiStyler(p, "1"), ansiStyler(p, "4")
+	var out strings.Builder
+	indent := roffIndent
+	for _, line := range strings.Split(src, "\n") {
+		macro, args := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			macro, args = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		if !strings.HasPrefix(line, ".") {
+			if text := strings.TrimSpace(line); text == "" {
+				out.WriteString("\n")
+			} else {
+				out.WriteString(indent + text + "\n")
+			}
+			continue
+		}
+		switch macro {
+		case ".Sh", ".SH":
+			indent = roffIndent
+			out.WriteString(roffBold(args) + "\n")
+		case ".Ss", ".SS":
+			indent = roffIndent
+			out.WriteString("   " + roffBold(args) + "\n")
+		case ".Nm":
+			indent = roffIndent
+			out.WriteString(indent + roffBold(args) + "\n")
+		case ".Nd":
+			indent = roffDescIndent
+			out.WriteString(indent + args + "\n")
+		case ".B", ".Sy":
+			out.WriteString(indent + roffBold(args) + "\n")
+		case ".I", ".Em":
+			out.WriteString(indent + roffUnderline(args) + "\n")
+		case ".Pp", ".PP", ".br":
+			out.WriteString("\n")
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,33 @@
+package term
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderRoff(t *testing.T) {
+	src := `.Dd 2023
+.Dt 0.1
+.\" a comment
+.Sh NAME
+.Nm pb
+.Nd the command line puzzle box
+
+.Sh OPTIONS
+.Nm --hint
+.Nd print out a stage specific hint that
+    goes on for a while
+.Pp
+plain text`
+	assert.Equal(t, "\033[1mNAME\033[m\n"+
+		"       \033[1mpb\033[m\n"+
+		"           the command line puzzle box\n"+
+		"\n"+
+		"\033[1mOPTIONS\033[m\n"+
+		"       \033[1m--hint\033[m\n"+
+		"           print out a stage specific hint that\n"+
+		"           goes on for a while\n"+
+		"\n"+
+		"           plain text\n", RenderRoff(src))
+}
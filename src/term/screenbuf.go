@@ -20,7 +20,11 @@ const (
 )
 
 func Fprint(out io.Writer, in string, data any) error {
-	return template.Must(template.New("screenbuf").Funcs(funcMap).Parse(in)).Execute(out, data)
+	return fprint(out, funcMap, in, data)
+}
+
+func fprint(out io.Writer, funcs template.FuncMap, in string, data any) error {
+	return template.Must(template.New("screenbuf").Funcs(funcs).Parse(in)).Execute(out, data)
 }
 
 // Println will print a formatted string out to a writer
@@ -56,7 +60,11 @@ type ScreenBuf struct {
 
 // NewScreenBuf creates and initializes a new ScreenBuf.
 func NewScreenBuf(w io.Writer, sources ...string) *ScreenBuf {
-	tmpl := template.New("screenbuf").Funcs(funcMap)
+	return newScreenBuf(w, funcMap, sources...)
+}
+
+func newScreenBuf(w io.Writer, funcs template.FuncMap, sources ...string) *ScreenBuf {
+	tmpl := template.New("screenbuf").Funcs(funcs)
 	for _, src := range sources {
 		template.Must(tmpl.Parse(src))
 	}
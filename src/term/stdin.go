@@ -0,0 +1,83 @@
+package term
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	// ErrStdinTooLarge is returned when more than PB_STDIN_MAX bytes are piped in
+	ErrStdinTooLarge = errors.New("too much was piped in")
+	// ErrStdinTimeout is returned when nothing more is piped in before
+	// PB_STDIN_TIMEOUT runs out
+	ErrStdinTimeout = errors.New("timed out waiting for stdin")
+)
+
+type (
+	// limitReader will fail once more than max bytes have been read, unlike
+	// io.LimitReader which quietly stops. It reads one byte past max to tell if
+	// there is more.
+	limitReader struct {
+		r   io.Reader
+		max int64
+		n   int64
+	}
+	// timeoutReader will fail if a read does not finish before the deadline. The
+	// read is left running in the background as a blocked stdin cannot be
+	// interrupted.
+	timeoutReader struct {
+		r        io.Reader
+		deadline time.Time
+	}
+	readResult struct {
+		n   int
+		err error
+	}
+)
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if lr.n > lr.max {
+		return 0, ErrStdinTooLarge
+	} else if int64(len(p)) > lr.max-lr.n+1 {
+		p = p[:lr.max-lr.n+1]
+	}
+	n, err := lr.r.Read(p)
+	if lr.n += int64(n); lr.n > lr.max {
+		return n - int(lr.n-lr.max), ErrStdinTooLarge
+	}
+	return n, err
+}
+
+func (tr *timeoutReader) Read(p []byte) (int, error) {
+	wait := time.Until(tr.deadline)
+	if wait <= 0 {
+		return 0, ErrStdinTimeout
+	}
+	buf := make([]byte, len(p))
+	done := make(chan readResult, 1)
+	go func() {
+		n, err := tr.r.Read(buf)
+		done <- readResult{n, err}
+	}()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return copy(p, buf[:res.n]), res.err
+	case <-timer.C:
+		return 0, ErrStdinTimeout
+	}
+}
+
+// newStdin will wrap the reader with the size cap and the timeout, which starts
+// from when the reader is created. A max or timeout of zero is not enforced.
+func newStdin(r io.Reader, max int64, timeout time.Duration) io.Reader {
+	if max > 0 {
+		r = &limitReader{r: r, max: max}
+	}
+	if timeout > 0 {
+		r = &timeoutReader{r: r, deadline: time.Now().Add(timeout)}
+	}
+	return r
+}
@@ -0,0 +1,46 @@
+package term
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStdinLimit(t *testing.T) {
+	data, err := io.ReadAll(newStdin(strings.NewReader("hello"), 5, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	data, err = io.ReadAll(newStdin(strings.NewReader("hello world"), 5, 0))
+	assert.ErrorIs(t, err, ErrStdinTooLarge)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestStdinTimeout(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("hello"))
+	stdin := newStdin(pr, 0, 50*time.Millisecond)
+	buf := make([]byte, 5)
+	n, err := stdin.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	_, err = stdin.Read(buf)
+	assert.ErrorIs(t, err, ErrStdinTimeout)
+}
+
+func TestNewInputDoesNotReadStdin(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	in, err := NewInput(Config{Args: []string{"--slot=test"}, Stdin: pr, Env: map[string]string{"HOME": t.TempDir()}})
+	assert.Nil(t, err)
+	assert.True(t, in.HasPipe)
+	go pw.Write([]byte("lazy"))
+	data := make([]byte, 4)
+	_, err = io.ReadFull(in.Stdin, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "lazy", string(data))
+}
@@ -0,0 +1,128 @@
+package term
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// ColorProfile is how many colors the output supports
+	ColorProfile int32
+	// Style is how a semantic name in a theme is shown. Attrs are always used and
+	// the color is picked for the profile, falling back to Basic when the theme
+	// does not have a color for it.
+	Style struct {
+		Attrs    []string
+		Basic    string
+		Color256 int
+		RGB      string
+	}
+	// Theme maps the semantic names used in templates, like command or danger,
+	// to their style
+	Theme map[string]Style
+)
+
+const (
+	// NoColor means nothing is styled, the output is plain text
+	NoColor ColorProfile = iota
+	// Color16 is the basic ANSI colors
+	Color16
+	// Color256 is the xterm 256 color palette
+	Color256
+	// TrueColor is 24-bit color
+	TrueColor
+)
+
+var (
+	// semanticNames are the names that every theme has to style
+	semanticNames = []string{"command", "link", "hint", "highlight", "success", "warning", "danger"}
+
+	// Themes are the themes that can be picked with PB_THEME
+	Themes = map[string]Theme{
+		"default": {
+			"command":   {Basic: "36", Color256: 44, RGB: "#00afd7"},
+			"link":      {Attrs: []string{"4"}, Basic: "36", Color256: 44, RGB: "#00afd7"},
+			"hint":      {Basic: "35", Color256: 170, RGB: "#d75fd7"},
+			"highlight": {Basic: "36", Color256: 80, RGB: "#5fd7d7"},
+			"success":   {Basic: "32", Color256: 78, RGB: "#5fd787"},
+			"warning":   {Basic: "33", Color256: 214, RGB: "#ffaf00"},
+			"danger":    {Basic: "31", Color256: 196, RGB: "#ff3030"},
+		},
+		"mono": {
+			"command":   {Attrs: []string{"1"}},
+			"link":      {Attrs: []string{"4"}},
+			"hint":      {Attrs: []string{"3"}},
+			"highlight": {Attrs: []string{"1"}},
+			"success":   {Attrs: []string{"1"}},
+			"warning":   {Attrs: []string{"1"}},
+			"danger":    {Attrs: []string{"1", "4"}},
+		},
+	}
+)
+
+// DetectColor will decide how much color the output supports. NO_COLOR and
+// TERM=dumb turn color off, as does output that is not a terminal.
+func DetectColor(tty bool, noColor, termName, colorTerm string) ColorProfile {
+	if !tty || noColor != "" || termName == "dumb" {
+		return NoColor
+	} else if colorTerm == "truecolor" || colorTerm == "24bit" {
+		return TrueColor
+	} else if strings.Contains(termName, "256color") {
+		return Color256
+	}
+	return Color16
+}
+
+// findTheme will return the theme with the name, or an error listing the
+// themes that can be picked
+func findTheme(name string) (Theme, error) {
+	selected, ok := Themes[name]
+	if !ok {
+		names := []string{}
+		for name := range Themes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown theme %q, pick one of %v", name, strings.Join(names, ", "))
+	}
+	return selected, nil
+}
+
+// codes will return the SGR codes for the style in the profile
+func (style Style) codes(p ColorProfile) []string {
+	codes := append([]string{}, style.Attrs...)
+	if r, g, b, ok := parseRGB(style.RGB); p == TrueColor && ok {
+		return append(codes, parseAnsiString(fmt.Sprintf(truefgcolor, r, g, b)).vals...)
+	} else if p >= Color256 && style.Color256 > 0 {
+		return append(codes, parseAnsiString(fmt.Sprintf(rgbfgcolor, style.Color256)).vals...)
+	} else if style.Basic != "" {
+		return append(codes, style.Basic)
+	}
+	return codes
+}
+
+func themeStyler(p ColorProfile, style Style) func(interface{}) string {
+	return func(v interface{}) string {
+		if p == NoColor {
+			return fmt.Sprintf("%v", v)
+		}
+		ansistr := parseAnsiString(fmt.Sprintf("%v", v))
+		for _, code := range style.codes(p) {
+			ansistr.add(code)
+		}
+		return ansistr.String()
+	}
+}
+
+func parseRGB(hex string) (r, g, b uint64, ok bool) {
+	if len(hex) != 7 || hex[0] != '#' {
+		return 0, 0, 0, false
+	}
+	rgb, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	return rgb >> 16, rgb >> 8 & 0xff, rgb & 0xff, true
+}
@@ -0,0 +1,55 @@
+package term
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectColor(t *testing.T) {
+	assert.Equal(t, NoColor, DetectColor(false, "", "xterm-256color", ""))
+	assert.Equal(t, NoColor, DetectColor(true, "1", "xterm-256color", ""))
+	assert.Equal(t, NoColor, DetectColor(true, "", "dumb", ""))
+	assert.Equal(t, Color16, DetectColor(true, "", "xterm", ""))
+	assert.Equal(t, Color256, DetectColor(true, "", "xterm-256color", ""))
+	assert.Equal(t, TrueColor, DetectColor(true, "", "xterm", "truecolor"))
+}
+
+func TestThemeStyler(t *testing.T) {
+	command := Themes["default"]["command"]
+	assert.Equal(t, "ls", themeStyler(NoColor, command)("ls"))
+	assert.Equal(t, "\033[36mls\033[m", themeStyler(Color16, command)("ls"))
+	assert.Equal(t, "\033[38;5;44mls\033[m", themeStyler(Color256, command)("ls"))
+	assert.Equal(t, "\033[38;2;0;175;215mls\033[m", themeStyler(TrueColor, command)("ls"))
+}
+
+func TestInputTheme(t *testing.T) {
+	plain, err := NewInput(Config{Env: map[string]string{"PB_STORE": "memory"}})
+	assert.Nil(t, err)
+	mono, err := NewInput(Config{IsTTY: true, ErrTTY: true, Env: map[string]string{
+		"PB_STORE":  "memory",
+		"PB_THEME":  "mono",
+		"COLORTERM": "truecolor",
+	}})
+	assert.Nil(t, err)
+	truecolor, err := NewInput(Config{IsTTY: true, ErrTTY: true, Env: map[string]string{
+		"PB_STORE":  "memory",
+		"COLORTERM": "truecolor",
+	}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "ls", plain.Sprintf(`{{"ls"|cyan|bold}}`, nil))
+	assert.Equal(t, "\033[1;4mrm\033[m", mono.Sprintf(`{{"rm"|danger}}`, nil))
+	assert.Equal(t, "\033[4;38;2;0;175;215mls\033[m", truecolor.Sprintf(`{{"ls"|link}}`, nil))
+	assert.Equal(t, "ls", plain.Sprintf(`{{"ls"|link}}`, nil))
+	assert.Equal(t, "\033[4;36mls\033[m", Sprintf(`{{"ls"|link}}`, nil))
+
+	_, err = NewInput(Config{Env: map[string]string{"PB_STORE": "memory", "PB_THEME": "neon"}})
+	assert.EqualError(t, err, `unknown theme "neon", pick one of default, mono`)
+
+	for name, theme := range Themes {
+		for _, semantic := range semanticNames {
+			assert.Contains(t, theme, semantic, "theme %v", name)
+		}
+	}
+}
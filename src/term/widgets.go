@@ -0,0 +1,226 @@
+//go:build !windows
+// +build !windows
+
+package term
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type (
+	// ProgressBar draws a bar that fills up as progress is set
+	ProgressBar struct {
+		screen *ScreenBuf
+		Label  string
+		Total  int
+		Width  int
+	}
+	selectData struct {
+		Label    string
+		Options  []string
+		Selected int
+	}
+	promptData struct {
+		Label, Text, Default string
+	}
+)
+
+const (
+	spinTmpl     = `{{.Glyph|command}} {{.Label}}`
+	progressTmpl = `{{.Label}} [{{.Done|command}}{{.Left|faint}}] {{.Percent}}%`
+	selectTmpl   = `{{.Label|bold}}
+{{- range $i, $opt := .Options}}
+{{if eq $i $.Selected}}{{"❯"|command}} {{$opt|command}}{{else}}  {{$opt}}{{end}}
+{{- end}}`
+	selectedTmpl  = `{{.Label|bold}} {{index .Options .Selected|command}}`
+	promptTmpl    = `{{.Label|bold}} {{if and (not .Text) .Default}}{{.Default|faint}}{{else}}{{.Text}}{{end}}▏`
+	countdownTmpl = `{{.Label}} {{.Left|warning}}`
+)
+
+var (
+	// ErrCountdownExpired is returned by Countdown when time runs out
+	ErrCountdownExpired = errors.New("time is up")
+
+	spinInterval      = 100 * time.Millisecond
+	countdownInterval = 100 * time.Millisecond
+)
+
+// Spin will show a spinner next to the label until the returned stop func is
+// called, which clears it.
+func Spin(w io.Writer, label string) (stop func()) {
+	screen := NewScreenBuf(w)
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(spinInterval)
+		defer ticker.Stop()
+		for i := 0; ; i = (i + 1) % len(spinGlyphs) {
+			screen.Render(spinTmpl, map[string]string{"Glyph": string(spinGlyphs[i]), "Label": label})
+			select {
+			case <-done:
+				screen.Reset()
+				screen.Flush()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// NewProgressBar will create a progress bar that is complete when it is set to
+// the total
+func NewProgressBar(w io.Writer, label string, total int) *ProgressBar {
+	return &ProgressBar{screen: NewScreenBuf(w), Label: label, Total: total, Width: 30}
+}
+
+// Set will redraw the bar with n out of the total done
+func (bar *ProgressBar) Set(n int) error {
+	if n > bar.Total {
+		n = bar.Total
+	} else if n < 0 {
+		n = 0
+	}
+	percent, filled := 100, bar.Width
+	if bar.Total > 0 {
+		percent, filled = n*100/bar.Total, n*bar.Width/bar.Total
+	}
+	return bar.screen.Render(progressTmpl, map[string]any{
+		"Label":   bar.Label,
+		"Done":    strings.Repeat("█", filled),
+		"Left":    strings.Repeat("░", bar.Width-filled),
+		"Percent": percent,
+	})
+}
+
+// Select will show the options as a list that the player moves through with the
+// arrow keys, or j and k, and picks one with enter. It returns the index of the
+// option that was picked.
+func Select(r io.Reader, w io.Writer, label string, options []string) (int, error) {
+	return selectOption(r, w, funcMap, label, options)
+}
+
+func selectOption(r io.Reader, w io.Writer, funcs template.FuncMap, label string, options []string) (int, error) {
+	if len(options) == 0 {
+		return 0, errors.New("nothing to select from")
+	}
+	w, restore, err := rawMode(r, w)
+	if err != nil {
+		return 0, err
+	}
+	defer restore()
+	keys, screen := NewKeyReader(r), newScreenBuf(w, funcs)
+	data := selectData{Label: label, Options: options}
+	for {
+		if err := screen.Render(selectTmpl, data); err != nil {
+			return 0, err
+		}
+		key, err := keys.ReadKey()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case key.Code == KeyInterrupt:
+			return 0, ErrInterrupt
+		case key.Code == KeyEnter:
+			return data.Selected, screen.Render(selectedTmpl, data)
+		case key.Code == KeyUp, key.Rune == 'k':
+			data.Selected = (data.Selected + len(options) - 1) % len(options)
+		case key.Code == KeyDown, key.Rune == 'j':
+			data.Selected = (data.Selected + 1) % len(options)
+		}
+	}
+}
+
+// Prompt will ask the player to type a line of text. If nothing is typed the
+// default is returned.
+func Prompt(r io.Reader, w io.Writer, label, def string) (string, error) {
+	return prompt(r, w, funcMap, label, def)
+}
+
+func prompt(r io.Reader, w io.Writer, funcs template.FuncMap, label, def string) (string, error) {
+	w, restore, err := rawMode(r, w)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	keys, screen := NewKeyReader(r), newScreenBuf(w, funcs)
+	data := promptData{Label: label, Default: def}
+	text := []rune{}
+	for {
+		data.Text = string(text)
+		if err := screen.Render(promptTmpl, data); err != nil {
+			return "", err
+		}
+		key, err := keys.ReadKey()
+		if err != nil {
+			return "", err
+		}
+		switch key.Code {
+		case KeyInterrupt:
+			return "", ErrInterrupt
+		case KeyEnter:
+			if len(text) == 0 {
+				text = []rune(def)
+			}
+			data.Text, data.Default = string(text), ""
+			return data.Text, screen.Render(promptTmpl, data)
+		case KeyBackspace:
+			if len(text) > 0 {
+				text = text[:len(text)-1]
+			}
+		case KeyRune:
+			text = append(text, key.Rune)
+		}
+	}
+}
+
+// Countdown will show the time left until the duration is up and return
+// ErrCountdownExpired. If the context is done first, because the challenge was
+// completed, it returns nil.
+func Countdown(ctx context.Context, w io.Writer, label string, d time.Duration) error {
+	screen := NewScreenBuf(w)
+	deadline := time.Now().Add(d)
+	ticker := time.NewTicker(countdownInterval)
+	defer ticker.Stop()
+	for {
+		left := time.Until(deadline)
+		if left < 0 {
+			left = 0
+		}
+		seconds := int((left + time.Second - 1) / time.Second)
+		screen.Render(countdownTmpl, map[string]string{
+			"Label": label,
+			"Left":  fmt.Sprintf("%02d:%02d", seconds/60, seconds%60),
+		})
+		if left == 0 {
+			return ErrCountdownExpired
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Select will let the player pick one of the options, using the keys piped in
+// or the terminal.
+func (in *Input) Select(label string, options []string) (int, error) {
+	return selectOption(in.keys(), in.Stderr, in.funcs, label, options)
+}
+
+// Prompt will ask the player to type a line of text, reading from what was
+// piped in or the terminal.
+func (in *Input) Prompt(label, def string) (string, error) {
+	return prompt(in.keys(), in.Stderr, in.funcs, label, def)
+}
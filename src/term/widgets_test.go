@@ -0,0 +1,103 @@
+package term
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadKey(t *testing.T) {
+	keys := NewKeyReader(strings.NewReader("a\033[A\033[B\033[C\033[D\r\x7f\t\x03\033"))
+	expected := []Key{
+		{Code: KeyRune, Rune: 'a'}, {Code: KeyUp}, {Code: KeyDown}, {Code: KeyRight},
+		{Code: KeyLeft}, {Code: KeyEnter}, {Code: KeyBackspace}, {Code: KeyTab},
+		{Code: KeyInterrupt}, {Code: KeyEscape},
+	}
+	for _, want := range expected {
+		key, err := keys.ReadKey()
+		assert.Nil(t, err)
+		assert.Equal(t, want, key)
+	}
+	_, err := keys.ReadKey()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestSelect(t *testing.T) {
+	var out bytes.Buffer
+	options := []string{"red", "green", "blue"}
+	i, err := Select(strings.NewReader("\033[B\033[Bj\033[A\r"), &out, "pick one", options)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, i)
+	assert.Contains(t, StripANSI(out.String()), "❯ blue")
+	assert.True(t, strings.HasSuffix(StripANSI(out.String()), "pick one blue\n"))
+
+	_, err = Select(strings.NewReader("j\x03"), &out, "pick one", options)
+	assert.Equal(t, ErrInterrupt, err)
+	_, err = Select(strings.NewReader("j"), &out, "pick one", options)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestPrompt(t *testing.T) {
+	var out bytes.Buffer
+	text, err := Prompt(strings.NewReader("tomx\x7f\r"), &out, "name?", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "tom", text)
+
+	text, err = Prompt(strings.NewReader("\r"), &out, "name?", "timmy")
+	assert.Nil(t, err)
+	assert.Equal(t, "timmy", text)
+}
+
+func TestInputPrompts(t *testing.T) {
+	in, err := NewInput(Config{Stdin: strings.NewReader("j\rjoe\ry\n"), Env: map[string]string{"PB_STORE": "memory"}})
+	assert.Nil(t, err)
+	i, err := in.Select("pick", []string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, i)
+	name, err := in.Prompt("name?", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "joe", name)
+	assert.True(t, in.Confirm("sure?"))
+
+	in, err = NewInput(Config{Terminal: strings.NewReader("y\n"), Env: map[string]string{"PB_STORE": "memory"}})
+	assert.Nil(t, err)
+	assert.True(t, in.Confirm("sure?"))
+	in, err = NewInput(Config{Env: map[string]string{"PB_STORE": "memory"}})
+	assert.Nil(t, err)
+	assert.False(t, in.Confirm("sure?"))
+}
+
+func TestProgressBar(t *testing.T) {
+	var out bytes.Buffer
+	bar := NewProgressBar(&out, "loading", 4)
+	bar.Width = 4
+	assert.Nil(t, bar.Set(2))
+	assert.Equal(t, "loading [██░░] 50%\n", StripANSI(out.String()))
+	out.Reset()
+	assert.Nil(t, bar.Set(10))
+	assert.Contains(t, StripANSI(out.String()), "loading [████] 100%\n")
+}
+
+func TestSpin(t *testing.T) {
+	var out bytes.Buffer
+	stop := Spin(&out, "thinking")
+	stop()
+	assert.Contains(t, StripANSI(out.String()), "⠋ thinking\n")
+}
+
+func TestCountdown(t *testing.T) {
+	var out bytes.Buffer
+	err := Countdown(context.Background(), &out, "hurry", 10*time.Millisecond)
+	assert.Equal(t, ErrCountdownExpired, err)
+	assert.Contains(t, StripANSI(out.String()), "hurry 00:01")
+	assert.True(t, strings.HasSuffix(StripANSI(out.String()), "hurry 00:00\n"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Nil(t, Countdown(ctx, &out, "hurry", time.Minute))
+}
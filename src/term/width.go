@@ -0,0 +1,60 @@
+package term
+
+import (
+	"sort"
+	"unicode"
+)
+
+const zeroWidthJoiner = '\u200d'
+
+// wideRanges are the runes that take up two columns in a terminal, the East
+// Asian wide and fullwidth characters and emoji presentation characters.
+var wideRanges = []struct{ lo, hi rune }{
+	{0x1100, 0x115F}, {0x231A, 0x231B}, {0x2329, 0x232A}, {0x23E9, 0x23EC},
+	{0x23F0, 0x23F0}, {0x23F3, 0x23F3}, {0x25FD, 0x25FE}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1},
+	{0x26AA, 0x26AB}, {0x26BD, 0x26BE}, {0x26C4, 0x26C5}, {0x26CE, 0x26CE},
+	{0x26D4, 0x26D4}, {0x26EA, 0x26EA}, {0x26F2, 0x26F3}, {0x26F5, 0x26F5},
+	{0x26FA, 0x26FA}, {0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B},
+	{0x2728, 0x2728}, {0x274C, 0x274C}, {0x274E, 0x274E}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27B0, 0x27B0}, {0x27BF, 0x27BF},
+	{0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x2E80, 0x303E},
+	{0x3041, 0x33FF}, {0x3400, 0x4DBF}, {0x4E00, 0x9FFF}, {0xA000, 0xA4CF},
+	{0xA960, 0xA97F}, {0xAC00, 0xD7A3}, {0xF900, 0xFAFF}, {0xFE10, 0xFE19},
+	{0xFE30, 0xFE6F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x1F004, 0x1F004},
+	{0x1F0CF, 0x1F0CF}, {0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A}, {0x1F200, 0x1F251},
+	{0x1F300, 0x1F64F}, {0x1F680, 0x1F6FF}, {0x1F900, 0x1F9FF}, {0x1FA70, 0x1FAFF},
+	{0x20000, 0x2FFFD}, {0x30000, 0x3FFFD},
+}
+
+// runeWidth will return how many columns the rune takes up in a terminal.
+// Control characters, combining marks and format characters like the zero
+// width joiner take up none.
+func runeWidth(r rune) int {
+	if r < 0x20 || (r >= 0x7f && r < 0xa0) {
+		return 0
+	} else if r < 0x300 {
+		return 1
+	} else if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	i := sort.Search(len(wideRanges), func(i int) bool { return wideRanges[i].hi >= r })
+	if i < len(wideRanges) && wideRanges[i].lo <= r {
+		return 2
+	}
+	return 1
+}
+
+// stringWidth will return how many columns the string takes up in a terminal,
+// ignoring ANSI escape codes. Characters joined into one emoji with a zero
+// width joiner only count once.
+func stringWidth(str string) int {
+	width, joined := 0, false
+	for _, r := range StripANSI(str) {
+		if !joined {
+			width += runeWidth(r)
+		}
+		joined = r == zeroWidthJoiner
+	}
+	return width
+}
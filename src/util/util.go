@@ -7,12 +7,21 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-
-	"github.com/tanema/pb/src/term"
 )
 
 var ErrorShowUsage = errors.New("showUsage")
 
+// StageChange is returned from a stage when it has been solved. It is handled
+// by stages.Run which will move the player on to the next stage.
+type StageChange struct {
+	Stage   string
+	Message string
+}
+
+func (change *StageChange) Error() string {
+	return fmt.Sprintf("advancing to stage %v", change.Stage)
+}
+
 func Base64(in string, data ...any) string {
 	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(in, data...)))
 }
@@ -25,16 +34,46 @@ func Hex(in string, data ...any) string {
 	return hex.EncodeToString([]byte(fmt.Sprintf(in, data...)))
 }
 
-func OnSignal(fn func(os.Signal), sig ...os.Signal) {
+// OnSignal will call fn every time one of the signals is received until the
+// returned stop func is called. Signals are read from src, or the signals sent
+// to the process if src is nil, and any others are ignored.
+func OnSignal(src <-chan os.Signal, fn func(os.Signal), sig ...os.Signal) func() {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, sig...)
-	for {
-		fn(<-c)
+	done := make(chan struct{})
+	if src == nil {
+		signal.Notify(c, sig...)
+		src = c
+	}
+	go func() {
+		for {
+			select {
+			case s := <-src:
+				if wanted(s, sig) {
+					fn(s)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+func wanted(s os.Signal, sig []os.Signal) bool {
+	for _, want := range sig {
+		if s == want {
+			return true
+		}
 	}
+	return false
 }
 
-func SetStage(in *term.Input, stage string) {
-	in.DB.Set("stage", stage)
-	in.DB.Set("hints", "0")
-	os.Exit(0)
+// SetStage will return a StageChange to be returned from a stage's Run func
+// to move the player on to the stage. The message will be printed once the
+// change has been saved.
+func SetStage(stage, message string) error {
+	return &StageChange{Stage: stage, Message: message}
 }